@@ -0,0 +1,112 @@
+package rpc_yqaty
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strconv"
+)
+
+var numberType = reflect.TypeOf(json.Number(""))
+
+func (codec *Decoder) UseNumber() {
+	codec.useNumber = true
+}
+
+func (codec *Decoder) peek() (string, error) {
+	str, err := codec.Read()
+	if err != nil {
+		return "", err
+	}
+	codec.unread(str)
+	return str, nil
+}
+
+func (codec *Decoder) decodeAny() (any, error) {
+	str, err := codec.Read()
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case str == "null":
+		return nil, nil
+	case str == "true" || str == "false":
+		return str == "true", nil
+	case str[0] == '"':
+		return unquote(str)
+	case str == "[":
+		if err := codec.enter(); err != nil {
+			return nil, err
+		}
+		defer codec.leave()
+		list := []any{}
+		if str, err = codec.peek(); err != nil {
+			return nil, err
+		}
+		if str == "]" {
+			codec.Read()
+			return list, nil
+		}
+		for {
+			if codec.limits.MaxCollection > 0 && len(list) >= codec.limits.MaxCollection {
+				return nil, codec.fail(errCollectionTooLong)
+			}
+			v, err := codec.decodeAny()
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+			if str, err = codec.Read(); err != nil {
+				return nil, err
+			}
+			if str == "]" {
+				return list, nil
+			}
+			if str != "," {
+				return nil, errors.New("decode failed")
+			}
+		}
+	case str == "{":
+		if err := codec.enter(); err != nil {
+			return nil, err
+		}
+		defer codec.leave()
+		object := map[string]any{}
+		for {
+			if str, err = codec.Read(); err != nil {
+				return nil, err
+			}
+			if str == "}" {
+				return object, nil
+			}
+			if len(object) > 0 {
+				if str != "," {
+					return nil, errors.New("decode failed")
+				}
+				if str, err = codec.Read(); err != nil {
+					return nil, err
+				}
+			}
+			if codec.limits.MaxCollection > 0 && len(object) >= codec.limits.MaxCollection {
+				return nil, codec.fail(errCollectionTooLong)
+			}
+			key, err := unquote(str)
+			if err != nil {
+				return nil, err
+			}
+			if err := codec.consume(":"); err != nil {
+				return nil, err
+			}
+			if object[key], err = codec.decodeAny(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if !validNumber(str) {
+		return nil, errors.New("decode failed: invalid value " + str)
+	}
+	if codec.useNumber {
+		return json.Number(str), nil
+	}
+	return strconv.ParseFloat(str, 64)
+}
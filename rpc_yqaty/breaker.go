@@ -0,0 +1,215 @@
+package rpc_yqaty
+
+import (
+	"strconv"
+	"sync"
+	"time"
+)
+
+type BreakerState int
+
+const (
+	BreakerClosed BreakerState = iota
+	BreakerOpen
+	BreakerHalfOpen
+)
+
+func (state BreakerState) String() string {
+	switch state {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+	return "BreakerState(" + strconv.Itoa(int(state)) + ")"
+}
+
+type BreakerConfig struct {
+	Window           time.Duration
+	MinRequests      int
+	ErrorRate        float64
+	SlowCall         time.Duration
+	SlowRate         float64
+	OpenTimeout      time.Duration
+	HalfOpenRequests int
+	OnStateChange    func(name string, from BreakerState, to BreakerState)
+}
+
+const breakerBuckets = 10
+
+var errBreakerOpen = &Error{Code: CodeUnavailable, Message: "circuit breaker is open"}
+
+type breakerBucket struct {
+	start  time.Time
+	total  int
+	failed int
+	slow   int
+}
+
+type CircuitBreaker struct {
+	name     string
+	config   BreakerConfig
+	mutex    sync.Mutex
+	state    BreakerState
+	openedAt time.Time
+	probes   int
+	passed   int
+	buckets  [breakerBuckets]breakerBucket
+	changes  [][2]BreakerState
+}
+
+func NewCircuitBreaker(name string, config BreakerConfig) *CircuitBreaker {
+	if config.Window <= 0 {
+		config.Window = 10 * time.Second
+	}
+	if config.MinRequests <= 0 {
+		config.MinRequests = 20
+	}
+	if config.ErrorRate <= 0 {
+		config.ErrorRate = 0.5
+	}
+	if config.OpenTimeout <= 0 {
+		config.OpenTimeout = 5 * time.Second
+	}
+	if config.HalfOpenRequests <= 0 {
+		config.HalfOpenRequests = 1
+	}
+	return &CircuitBreaker{name: name, config: config}
+}
+
+func (breaker *CircuitBreaker) State() BreakerState {
+	breaker.mutex.Lock()
+	defer breaker.mutex.Unlock()
+	if breaker.state == BreakerOpen && time.Since(breaker.openedAt) >= breaker.config.OpenTimeout {
+		return BreakerHalfOpen
+	}
+	return breaker.state
+}
+
+func (breaker *CircuitBreaker) setState(state BreakerState, now time.Time) {
+	from := breaker.state
+	breaker.state = state
+	breaker.probes, breaker.passed = 0, 0
+	switch state {
+	case BreakerOpen:
+		breaker.openedAt = now
+	case BreakerClosed:
+		breaker.buckets = [breakerBuckets]breakerBucket{}
+	}
+	if from != state && breaker.config.OnStateChange != nil {
+		breaker.changes = append(breaker.changes, [2]BreakerState{from, state})
+	}
+}
+
+func (breaker *CircuitBreaker) unlock() {
+	changes := breaker.changes
+	breaker.changes = nil
+	breaker.mutex.Unlock()
+	for _, change := range changes {
+		breaker.config.OnStateChange(breaker.name, change[0], change[1])
+	}
+}
+
+func (breaker *CircuitBreaker) Allow() error {
+	breaker.mutex.Lock()
+	defer breaker.unlock()
+	now := time.Now()
+	if breaker.state == BreakerOpen {
+		if now.Sub(breaker.openedAt) < breaker.config.OpenTimeout {
+			return errBreakerOpen
+		}
+		breaker.setState(BreakerHalfOpen, now)
+	}
+	if breaker.state == BreakerHalfOpen {
+		if breaker.probes >= breaker.config.HalfOpenRequests {
+			return errBreakerOpen
+		}
+		breaker.probes++
+	}
+	return nil
+}
+
+func (breaker *CircuitBreaker) Record(err error, latency time.Duration) {
+	breaker.mutex.Lock()
+	defer breaker.unlock()
+	now := time.Now()
+	failed := breakerFailure(err)
+	slow := breaker.config.SlowCall > 0 && latency >= breaker.config.SlowCall
+	switch breaker.state {
+	case BreakerHalfOpen:
+		if failed || slow {
+			breaker.setState(BreakerOpen, now)
+		} else if breaker.passed++; breaker.passed >= breaker.config.HalfOpenRequests {
+			breaker.setState(BreakerClosed, now)
+		}
+		return
+	case BreakerOpen:
+		return
+	}
+	span := breaker.config.Window / breakerBuckets
+	bucket := &breaker.buckets[now.UnixNano()/int64(span)%breakerBuckets]
+	if start := now.Truncate(span); !bucket.start.Equal(start) {
+		*bucket = breakerBucket{start: start}
+	}
+	bucket.total++
+	if failed {
+		bucket.failed++
+	}
+	if slow {
+		bucket.slow++
+	}
+	var total, failures, slows int
+	for _, b := range breaker.buckets {
+		if now.Sub(b.start) < breaker.config.Window {
+			total += b.total
+			failures += b.failed
+			slows += b.slow
+		}
+	}
+	if total < breaker.config.MinRequests {
+		return
+	}
+	if float64(failures) >= breaker.config.ErrorRate*float64(total) || (breaker.config.SlowRate > 0 && float64(slows) >= breaker.config.SlowRate*float64(total)) {
+		breaker.setState(BreakerOpen, now)
+	}
+}
+
+func breakerFailure(err error) bool {
+	switch ErrorCode(err) {
+	case CodeDeadlineExceeded, CodeResourceExhausted, CodeUnavailable, CodeInternal:
+		return true
+	}
+	return false
+}
+
+func (client *Client) SetMethodBreaker(name string, config BreakerConfig) {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+	client.breakers[name] = NewCircuitBreaker(name, config)
+}
+
+func (client *Client) breaker(name string) *CircuitBreaker {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+	if breaker, ok := client.breakers[name]; ok {
+		return breaker
+	}
+	if client.Breaker == nil {
+		return nil
+	}
+	breaker, ok := client.breakers[""]
+	if !ok {
+		breaker = NewCircuitBreaker("", *client.Breaker)
+		client.breakers[""] = breaker
+	}
+	return breaker
+}
+
+func (client *Client) BreakerState(name string) BreakerState {
+	if breaker := client.breaker(name); breaker != nil {
+		return breaker.State()
+	}
+	return BreakerClosed
+}
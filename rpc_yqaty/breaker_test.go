@@ -0,0 +1,60 @@
+package rpc_yqaty
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBreaker(t *testing.T) {
+	server := GetServer()
+	server.Register("flaky", (*Func).Flaky)
+	server.Register("add", (*Func).Add)
+	client := GetClient()
+	if err := client.Dial(serve(t, server)); err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	var mutex sync.Mutex
+	var changes []BreakerState
+	client.Breaker = &BreakerConfig{MinRequests: 4, OpenTimeout: 100 * time.Millisecond, OnStateChange: func(name string, from BreakerState, to BreakerState) {
+		mutex.Lock()
+		changes = append(changes, to)
+		mutex.Unlock()
+	}}
+	client.SetMethodBreaker("add", BreakerConfig{})
+
+	attempts = 0
+	for i := 0; i < 4; i++ {
+		if err := client.Call("flaky", Struct1{1 << 20, 0}, new(int)); ErrorCode(err) != CodeUnavailable || err == errBreakerOpen {
+			t.Fatalf("expect the call to reach the server, output %v", err)
+		}
+	}
+	if state := client.BreakerState("flaky"); state != BreakerOpen {
+		t.Fatalf("expect %v, output %v", BreakerOpen, state)
+	}
+	if err := client.Call("flaky", Struct1{}, new(int)); err != errBreakerOpen || attempts != 4 {
+		t.Errorf("expect to fail fast, output %v after %v attempts", err, attempts)
+	}
+	if err := client.Call("add", Struct1{1, 2}, new(int)); err != nil {
+		t.Errorf("add: expect its own breaker to stay closed, output %v", err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if state := client.BreakerState("flaky"); state != BreakerHalfOpen {
+		t.Errorf("expect %v, output %v", BreakerHalfOpen, state)
+	}
+	attempts = 0
+	if err := client.Call("flaky", Struct1{}, new(int)); err != nil {
+		t.Fatal(err)
+	}
+	if state := client.BreakerState("flaky"); state != BreakerClosed {
+		t.Errorf("expect %v, output %v", BreakerClosed, state)
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	if len(changes) != 3 || changes[0] != BreakerOpen || changes[1] != BreakerHalfOpen || changes[2] != BreakerClosed {
+		t.Errorf("unexpected state changes %v", changes)
+	}
+}
@@ -0,0 +1,119 @@
+package rpc_yqaty
+
+import (
+	"container/list"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+type CacheStats struct {
+	Hits    uint64
+	Misses  uint64
+	Entries int
+}
+
+type cacheEntry struct {
+	key     string
+	reply   reflect.Value
+	expires time.Time
+}
+
+type responseCache struct {
+	ttl        time.Duration
+	maxEntries int
+	mutex      sync.Mutex
+	entries    map[string]*list.Element
+	lru        *list.List
+	hits       uint64
+	misses     uint64
+}
+
+func Cacheable(ttl time.Duration, maxEntries int) MethodOption {
+	return func(method *MethodType) {
+		method.Cache = &responseCache{ttl: ttl, maxEntries: maxEntries, entries: make(map[string]*list.Element), lru: list.New()}
+	}
+}
+
+func (cache *responseCache) get(key string) (reflect.Value, bool) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	if elem, ok := cache.entries[key]; ok {
+		entry := elem.Value.(*cacheEntry)
+		if cache.ttl <= 0 || time.Now().Before(entry.expires) {
+			cache.lru.MoveToFront(elem)
+			cache.hits++
+			return entry.reply, true
+		}
+		cache.remove(elem)
+	}
+	cache.misses++
+	return reflect.Value{}, false
+}
+
+func (cache *responseCache) put(key string, reply reflect.Value) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	if elem, ok := cache.entries[key]; ok {
+		cache.remove(elem)
+	}
+	cache.entries[key] = cache.lru.PushFront(&cacheEntry{key: key, reply: reply, expires: time.Now().Add(cache.ttl)})
+	for cache.maxEntries > 0 && cache.lru.Len() > cache.maxEntries {
+		cache.remove(cache.lru.Back())
+	}
+}
+
+func (cache *responseCache) remove(elem *list.Element) {
+	cache.lru.Remove(elem)
+	delete(cache.entries, elem.Value.(*cacheEntry).key)
+}
+
+func (cache *responseCache) invalidate(prefix string) int {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	n := 0
+	for key, elem := range cache.entries {
+		if strings.HasPrefix(key, prefix) {
+			cache.remove(elem)
+			n++
+		}
+	}
+	return n
+}
+
+func (server *Server) CacheStats(name string) CacheStats {
+	method, ok := server.Mp[name]
+	if !ok || method.Cache == nil {
+		return CacheStats{}
+	}
+	method.Cache.mutex.Lock()
+	defer method.Cache.mutex.Unlock()
+	return CacheStats{Hits: method.Cache.hits, Misses: method.Cache.misses, Entries: method.Cache.lru.Len()}
+}
+
+func (server *Server) InvalidateCache(name string, prefix string) int {
+	method, ok := server.Mp[name]
+	if !ok || method.Cache == nil {
+		return 0
+	}
+	return method.Cache.invalidate(prefix)
+}
+
+func (server *Server) invokeCached(method *MethodType, args reflect.Value) (reflect.Value, error) {
+	if method.Cache == nil {
+		return server.invoke(method, args)
+	}
+	key, err := Marshal(args.Interface())
+	if err != nil {
+		return server.invoke(method, args)
+	}
+	if reply, ok := method.Cache.get(key); ok {
+		return reply, nil
+	}
+	reply, err := server.invoke(method, args)
+	if err == nil {
+		method.Cache.put(key, reply)
+	}
+	return reply, err
+}
@@ -0,0 +1,37 @@
+package rpc_yqaty
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCacheable(t *testing.T) {
+	server := GetServer()
+	server.Register("counted", (*Func).Counted, Cacheable(time.Minute, 2))
+	client := GetClient()
+	if err := client.Dial(serve(t, server)); err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	atomic.StoreInt32(&counted, 0)
+	for _, args := range []Struct1{{1, 2}, {1, 2}, {3, 4}, {1, 2}, {5, 6}, {3, 4}} {
+		var reply int
+		if err := client.Call("counted", args, &reply); err != nil || reply != args.A+args.B {
+			t.Fatalf("expect %v, output %v %v", args.A+args.B, reply, err)
+		}
+	}
+	if n := atomic.LoadInt32(&counted); n != 4 {
+		t.Errorf("expect 4 handler calls, output %v", n)
+	}
+	if stats := server.CacheStats("counted"); stats != (CacheStats{Hits: 2, Misses: 4, Entries: 2}) {
+		t.Errorf("unexpected cache stats %+v", stats)
+	}
+	if n := server.InvalidateCache("counted", "{\"A\":5"); n != 1 {
+		t.Errorf("expect 1 invalidated entry, output %v", n)
+	}
+	if n := server.InvalidateCache("counted", ""); n != 1 {
+		t.Errorf("expect 1 invalidated entry, output %v", n)
+	}
+}
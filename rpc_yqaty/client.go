@@ -1,52 +1,64 @@
 package rpc_yqaty
 
 import (
-	"bytes"
 	"errors"
-	"fmt"
 	"io"
 	"log"
 	"net"
 	"sync"
-	"text/scanner"
+	"sync/atomic"
 	"time"
 )
 
+type clientCodec interface {
+	WriteRequest(req *Request, data any) error
+	ReadResponseHeader(resp *Response) error
+	ReadResponseBody(data *Data) error
+	Close() error
+}
+
 type ClientCodec struct {
-	conn    io.ReadWriteCloser
-	encoder *Encoder
-	decoder *Decoder
+	conn        io.ReadWriteCloser
+	writer      *messageWriter
+	decoder     *Decoder
+	compression string
 }
 
 func (codec *ClientCodec) WriteRequest(req *Request, data any) error {
-	codec.encoder.s = new(bytes.Buffer)
-	if err := codec.encoder.JSONEncode(req); err != nil {
-		fmt.Println(err)
-		return err
-	}
-	if err := codec.encoder.JSONEncode(data); err != nil {
-		return err
+	err := codec.writer.write(req, &req.Compression, data)
+	if errors.Is(err, errBrokenStream) {
+		codec.conn.Close()
 	}
-	codec.encoder.s.WriteString(" ")
-	_, err := codec.conn.Write(codec.encoder.s.Bytes())
 	return err
 }
 
 func (codec *ClientCodec) ReadResponseHeader(resp *Response) error {
-	return codec.decoder.JSONDecode(resp)
+	codec.decoder.begin()
+	err := codec.decoder.JSONDecode(resp)
+	codec.compression = resp.Compression
+	return err
 }
 
 func (codec *ClientCodec) ReadResponseBody(data *Data) error {
-	return codec.decoder.JSONDecode(data)
+	if data == nil {
+		return codec.decoder.decodeBody(codec.compression, nil)
+	}
+	return codec.decoder.decodeBody(codec.compression, data)
+}
+
+func (codec *ClientCodec) Close() error {
+	return codec.conn.Close()
 }
 
 type Query struct {
-	Method string
-	Args   any
-	Reply  any
-	Error  error
-	seq    uint64
-	Done   chan *Query
+	Method         string
+	Args           any
+	Reply          any
+	Error          error
+	IdempotencyKey string
+	seq            uint64
+	frame          int
+	Done           chan *Query
 }
 
 func (query *Query) done() {
@@ -58,14 +70,35 @@ func (query *Query) done() {
 }
 
 type Client struct {
-	mutex   sync.Mutex
-	codec   ClientCodec
-	pending map[uint64]*Query
-	seq     uint64
-	closing bool
+	mutex               sync.Mutex
+	codec               clientCodec
+	pending             map[uint64]*Query
+	streams             map[uint64]*clientStream
+	seq                 uint64
+	closing             bool
+	StreamWindow        uint64
+	Principal           string
+	Retry               RetryPolicy
+	Breaker             *BreakerConfig
+	idempotent          map[string]bool
+	breakers            map[string]*CircuitBreaker
+	collapse            map[string]time.Duration
+	flights             flightGroup
+	HeartbeatInterval   time.Duration
+	MaxMissedHeartbeats int
+	lastSeen            atomic.Int64
+	dead                atomic.Bool
+	Features            []string
+	Compression         []string
+	CompressThreshold   int
+	Limits              DecodeLimits
+	protocol            Hello
 }
 
 func (client *Client) SendRequest(req *Request, data any) error {
+	if req.Frame == FrameCall {
+		req.Principal = client.Principal
+	}
 	client.mutex.Lock()
 	defer client.mutex.Unlock()
 	if err := client.codec.WriteRequest(req, data); err != nil {
@@ -75,12 +108,18 @@ func (client *Client) SendRequest(req *Request, data any) error {
 }
 
 func (client *Client) InitCodec(conn io.ReadWriteCloser) error {
-	client.codec = ClientCodec{conn: conn, decoder: &Decoder{&scanner.Scanner{}}, encoder: &Encoder{&bytes.Buffer{}}}
-	client.codec.decoder.s.Init(conn)
+	codec := &ClientCodec{conn: conn, decoder: newDecoder(conn, client.Limits), writer: newMessageWriter(conn)}
+	client.codec = codec
 	return nil
 }
 
 func (client *Client) Listen() {
+	stop := make(chan struct{})
+	defer close(stop)
+	client.lastSeen.Store(time.Now().UnixNano())
+	if _, ok := client.codec.(*ClientCodec); ok && client.HeartbeatInterval > 0 {
+		go client.heartbeat(stop)
+	}
 	var err error
 	for {
 		resp := Response{}
@@ -88,17 +127,29 @@ func (client *Client) Listen() {
 		if err != nil {
 			break
 		}
+		client.lastSeen.Store(time.Now().UnixNano())
+		if resp.Frame != FrameCall && resp.Frame != FrameHello {
+			if err = client.dealStream(&resp); err != nil {
+				break
+			}
+			continue
+		}
 		client.mutex.Lock()
 		query := client.pending[resp.Seq]
 		delete(client.pending, resp.Seq)
+		stream := client.streams[resp.Seq]
+		delete(client.streams, resp.Seq)
 		client.mutex.Unlock()
+		if stream != nil {
+			stream.finish(io.EOF)
+		}
 		if query == nil {
 			client.codec.ReadResponseBody(nil)
 			continue
 		}
 		if resp.Error != "" {
 			client.codec.ReadResponseBody(nil)
-			query.Error = errors.New(resp.Error)
+			query.Error = responseError(&resp)
 			query.done()
 			continue
 		}
@@ -106,17 +157,36 @@ func (client *Client) Listen() {
 		data.Reply = query.Reply
 		err = client.codec.ReadResponseBody(&data)
 		if err != nil {
+			query.Error = err
+			if _, ok := err.(*Error); !ok {
+				query.Error = &Error{Code: CodeUnavailable, Message: err.Error()}
+			}
+			query.done()
 			break
 		}
 		query.Reply = data.Reply
 		query.done()
 	}
+	if client.dead.Load() {
+		err = errHeartbeat
+	}
 	client.mutex.Lock()
 	client.closing = true
 	for _, query := range client.pending {
-		query.Error = err
+		if _, ok := err.(*Error); ok {
+			query.Error = err
+		} else {
+			query.Error = &Error{Code: CodeUnavailable, Message: err.Error()}
+		}
 		query.done()
 	}
+	for _, stream := range client.streams {
+		if err == io.EOF {
+			stream.finish(io.ErrUnexpectedEOF)
+		} else {
+			stream.finish(err)
+		}
+	}
 	client.mutex.Unlock()
 }
 
@@ -126,46 +196,79 @@ func (client *Client) Dial(addr string) error {
 		return err
 	}
 	client.InitCodec(conn)
-	go client.Listen()
-	return nil
+	return client.start()
 }
 
 func (client *Client) Deal(query *Query) {
 	client.mutex.Lock()
 	if client.closing {
+		client.mutex.Unlock()
+		query.Error = errShutdown
 		query.done()
-		query.Error = errors.New("the connection is shut down")
 		return
 	}
 	client.seq++
 	client.pending[client.seq] = query
 	query.seq = client.seq
-	req := Request{MethodName: query.Method, Seq: client.seq}
+	req := Request{MethodName: query.Method, Seq: client.seq, Frame: query.frame, IdempotencyKey: query.IdempotencyKey}
 	client.mutex.Unlock()
-	client.SendRequest(&req, query.Args)
+	if err := client.SendRequest(&req, query.Args); err != nil {
+		client.mutex.Lock()
+		delete(client.pending, query.seq)
+		client.mutex.Unlock()
+		query.Error = &Error{Code: CodeUnavailable, Message: err.Error()}
+		query.done()
+	}
 }
 
-func (client *Client) Call(name string, args any, reply any) error {
-	query := Query{Method: name, Args: args, Reply: reply, Error: nil, Done: make(chan *Query, 1)}
-	tick := time.NewTicker(5 * time.Second)
-	defer tick.Stop()
-	go client.Deal(&query)
-	cnt := 0
+func (client *Client) call(name string, key string, args any, reply any) (err error) {
+	if breaker := client.breaker(name); breaker != nil {
+		if err := breaker.Allow(); err != nil {
+			return err
+		}
+		start := time.Now()
+		defer func() {
+			breaker.Record(err, time.Since(start))
+		}()
+	}
+	query := Query{Method: name, Args: args, Reply: reply, IdempotencyKey: key, Done: make(chan *Query, 1)}
+	timer := time.NewTimer(callTimeout)
+	defer timer.Stop()
+	client.Deal(&query)
 	select {
 	case <-query.Done:
-		break
-	case <-tick.C:
+		return query.Error
+	case <-timer.C:
 		client.mutex.Lock()
 		delete(client.pending, query.seq)
 		client.mutex.Unlock()
-		if cnt++; cnt >= 1 {
-			query.Error = errors.New("can not receive response")
-			break
+		return errTimeout
+	}
+}
+
+func (client *Client) Call(name string, args any, reply any) error {
+	if ttl, ok := client.collapsed(name); ok {
+		return client.callShared(name, args, reply, ttl)
+	}
+	return client.callRetry(name, args, reply)
+}
+
+func (client *Client) callRetry(name string, args any, reply any) error {
+	key := ""
+	if client.isIdempotent(name) {
+		key = newIdempotencyKey()
+	}
+	for attempt := 1; ; attempt++ {
+		err := client.call(name, key, args, reply)
+		if err == nil || !client.isIdempotent(name) || !client.Retry.retryable(err, attempt) {
+			return err
 		}
-		query = Query{Method: name, Args: args, Reply: reply, Error: nil, Done: make(chan *Query, 1)}
-		go client.Deal(&query)
+		time.Sleep(client.Retry.backoff(attempt))
 	}
-	return query.Error
+}
+
+func (client *Client) Notify(name string, args any) error {
+	return client.SendRequest(&Request{MethodName: name}, args)
 }
 
 func (client *Client) Close() error {
@@ -175,11 +278,15 @@ func (client *Client) Close() error {
 		return errors.New("the connect is shut down")
 	}
 	client.closing = true
-	return client.codec.conn.Close()
+	return client.codec.Close()
 }
 
 func GetClient() *Client {
 	client := Client{}
 	client.pending = make(map[uint64]*Query)
+	client.streams = make(map[uint64]*clientStream)
+	client.idempotent = make(map[string]bool)
+	client.breakers = make(map[string]*CircuitBreaker)
+	client.collapse = make(map[string]time.Duration)
 	return &client
 }
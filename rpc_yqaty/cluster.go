@@ -0,0 +1,176 @@
+package rpc_yqaty
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+func (client *Client) Go(name string, args any, reply any, done chan *Query) *Query {
+	if done == nil {
+		done = make(chan *Query, 1)
+	}
+	query := &Query{Method: name, Args: args, Reply: reply, Done: done}
+	if client.isIdempotent(name) {
+		query.IdempotencyKey = newIdempotencyKey()
+	}
+	client.Deal(query)
+	return query
+}
+
+func (client *Client) abandon(query *Query) bool {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+	if client.pending[query.seq] != query {
+		return false
+	}
+	delete(client.pending, query.seq)
+	return true
+}
+
+func (client *Client) cancel(query *Query) {
+	if client.abandon(query) {
+		client.SendRequest(&Request{Seq: query.seq, Frame: FrameCancel}, nil)
+	}
+}
+
+type ClusterClient struct {
+	Clients    []*Client
+	HedgeDelay time.Duration
+	MaxHedges  int
+	mutex      sync.Mutex
+	readOnly   map[string]bool
+	next       uint32
+}
+
+func DialCluster(addrs ...string) (*ClusterClient, error) {
+	if len(addrs) == 0 {
+		return nil, errors.New("cluster: no endpoints")
+	}
+	cluster := &ClusterClient{readOnly: make(map[string]bool)}
+	for _, addr := range addrs {
+		client := GetClient()
+		if err := client.Dial(addr); err != nil {
+			cluster.Close()
+			return nil, err
+		}
+		cluster.Clients = append(cluster.Clients, client)
+	}
+	return cluster, nil
+}
+
+func (cluster *ClusterClient) MarkReadOnly(names ...string) {
+	cluster.mutex.Lock()
+	defer cluster.mutex.Unlock()
+	for _, name := range names {
+		cluster.readOnly[name] = true
+	}
+}
+
+func (cluster *ClusterClient) isReadOnly(name string) bool {
+	cluster.mutex.Lock()
+	defer cluster.mutex.Unlock()
+	return cluster.readOnly[name]
+}
+
+func (cluster *ClusterClient) Call(name string, args any, reply any) error {
+	start := int(atomic.AddUint32(&cluster.next, 1)) % len(cluster.Clients)
+	if cluster.HedgeDelay <= 0 || len(cluster.Clients) < 2 || !cluster.isReadOnly(name) {
+		return cluster.Clients[start].Call(name, args, reply)
+	}
+	return cluster.hedge(start, name, args, reply)
+}
+
+type hedgeAttempt struct {
+	client  *Client
+	breaker *CircuitBreaker
+	start   time.Time
+	reply   reflect.Value
+}
+
+func (cluster *ClusterClient) hedge(start int, name string, args any, reply any) error {
+	target := reflect.ValueOf(reply)
+	if target.Kind() != reflect.Pointer || target.IsNil() {
+		return &Error{Code: CodeInvalidArgument, Message: "cluster: reply must be a non-nil pointer"}
+	}
+	limit := len(cluster.Clients)
+	if cluster.MaxHedges > 0 && cluster.MaxHedges+1 < limit {
+		limit = cluster.MaxHedges + 1
+	}
+	results := make(chan *Query, limit)
+	attempts := make(map[*Query]*hedgeAttempt, limit)
+	key := newIdempotencyKey()
+	var err error
+	tried, launched := 0, 0
+	launch := func() {
+		for tried < len(cluster.Clients) && launched < limit {
+			client := cluster.Clients[(start+tried)%len(cluster.Clients)]
+			tried++
+			breaker := client.breaker(name)
+			if breaker != nil {
+				if berr := breaker.Allow(); berr != nil {
+					err = berr
+					continue
+				}
+			}
+			launched++
+			attempt := &hedgeAttempt{client: client, breaker: breaker, start: time.Now(), reply: reflect.New(target.Type().Elem())}
+			query := &Query{Method: name, Args: args, Reply: attempt.reply.Interface(), Done: results}
+			if client.isIdempotent(name) {
+				query.IdempotencyKey = key
+			}
+			attempts[query] = attempt
+			client.Deal(query)
+			return
+		}
+	}
+	finish := func(query *Query, err error) {
+		attempt := attempts[query]
+		delete(attempts, query)
+		if attempt.breaker != nil {
+			attempt.breaker.Record(err, time.Since(attempt.start))
+		}
+	}
+	defer func() {
+		for query, attempt := range attempts {
+			attempt.client.cancel(query)
+			finish(query, nil)
+		}
+	}()
+
+	timeout := time.NewTimer(callTimeout)
+	defer timeout.Stop()
+	hedge := time.NewTimer(cluster.HedgeDelay)
+	defer hedge.Stop()
+	launch()
+	for len(attempts) > 0 {
+		select {
+		case query := <-results:
+			finish(query, query.Error)
+			if query.Error == nil {
+				target.Elem().Set(reflect.ValueOf(query.Reply).Elem())
+				return nil
+			}
+			err = query.Error
+			launch()
+		case <-hedge.C:
+			launch()
+			hedge.Reset(cluster.HedgeDelay)
+		case <-timeout.C:
+			return errTimeout
+		}
+	}
+	return err
+}
+
+func (cluster *ClusterClient) Close() error {
+	var err error
+	for _, client := range cluster.Clients {
+		if cerr := client.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
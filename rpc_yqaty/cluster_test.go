@@ -0,0 +1,82 @@
+package rpc_yqaty
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var slowCalls atomic.Int32
+
+func (f *Func) Slow(A Struct1, B *int) error {
+	slowCalls.Add(1)
+	time.Sleep(300 * time.Millisecond)
+	*B = A.B
+	return nil
+}
+
+func TestHedge(t *testing.T) {
+	slow, fast := GetServer(), GetServer()
+	slow.Register("get", (*Func).Slow)
+	slowCalls.Store(0)
+	pool := NewWorkerPool(1, 16)
+	defer pool.Close()
+	slow.Executor = pool
+	fast.Register("get", (*Func).Sleep)
+	cluster, err := DialCluster(serve(t, slow), serve(t, fast))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cluster.Close()
+	cluster.HedgeDelay = 20 * time.Millisecond
+	cluster.MarkReadOnly("get")
+
+	for i := 0; i < 4; i++ {
+		var reply int
+		begin := time.Now()
+		if err := cluster.Call("get", Struct1{0, i}, &reply); err != nil || reply != i {
+			t.Fatalf("expect %v, output %v %v", i, reply, err)
+		}
+		if cost := time.Since(begin); cost > 200*time.Millisecond {
+			t.Errorf("expect the hedged call to win, took %v", cost)
+		}
+	}
+
+	time.Sleep(400 * time.Millisecond)
+	if calls := slowCalls.Swap(0); calls != 1 {
+		t.Errorf("expect the queued losing attempt to be canceled, slow endpoint ran %v times", calls)
+	}
+
+	if err := cluster.Call("get", Struct1{}, nil); ErrorCode(err) != CodeInvalidArgument {
+		t.Errorf("expect an error for a nil reply, output %v", err)
+	}
+	cluster.Clients[1].SetMethodBreaker("get", BreakerConfig{MinRequests: 1, OpenTimeout: time.Minute})
+	cluster.Clients[1].breaker("get").Record(errBreakerOpen, 0)
+	for i := 0; i < 2; i++ {
+		var reply int
+		begin := time.Now()
+		if err := cluster.Call("get", Struct1{0, i}, &reply); err != nil || reply != i {
+			t.Fatalf("expect %v, output %v %v", i, reply, err)
+		}
+		if cost := time.Since(begin); cost < 300*time.Millisecond {
+			t.Errorf("expect no hedge to an endpoint with an open breaker, took %v", cost)
+		}
+	}
+	cluster.Clients[1].SetMethodBreaker("get", BreakerConfig{})
+	slowCalls.Store(0)
+
+	cluster.HedgeDelay = 0
+	slowest := time.Duration(0)
+	for i := 0; i < 2; i++ {
+		begin := time.Now()
+		if err := cluster.Call("get", Struct1{0, i}, new(int)); err != nil {
+			t.Fatal(err)
+		}
+		if cost := time.Since(begin); cost > slowest {
+			slowest = cost
+		}
+	}
+	if slowest < 300*time.Millisecond {
+		t.Errorf("expect round robin to hit the slow endpoint without hedging, slowest %v", slowest)
+	}
+}
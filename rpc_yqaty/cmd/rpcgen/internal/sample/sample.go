@@ -0,0 +1,43 @@
+package sample
+
+import "time"
+
+//go:generate go run rpc_yqaty/rpc_yqaty/cmd/rpcgen
+
+type Level int8
+
+type Base struct {
+	ID      uint64
+	Created time.Time
+}
+
+type Meta struct {
+	Labels map[string]string
+	Score  float32
+}
+
+type audit struct {
+	Editor string
+}
+
+//rpcgen:codec
+type Record struct {
+	Base
+	*Meta
+	audit
+	Name    string
+	Level   Level
+	Ratio   float64
+	Active  bool
+	Tags    []string
+	Timeout time.Duration
+	Next    *Record
+	secret  string
+}
+
+//rpcgen:codec
+type Page struct {
+	Records []Record
+	Cursor  string
+	Total   int
+}
@@ -0,0 +1,100 @@
+// Code generated by rpcgen; DO NOT EDIT.
+
+package sample
+
+import "rpc_yqaty/rpc_yqaty"
+
+func (x Record) EncodeRPC(e *rpc_yqaty.ObjectEncoder) {
+	rpc_yqaty.EncodeUint(e, "ID", x.Base.ID)
+	e.Value("Created", &x.Base.Created)
+	if x.Meta != nil {
+		e.Value("Labels", &x.Meta.Labels)
+		rpc_yqaty.EncodeFloat(e, "Score", x.Meta.Score)
+	}
+	rpc_yqaty.EncodeString(e, "Editor", x.audit.Editor)
+	rpc_yqaty.EncodeString(e, "Name", x.Name)
+	rpc_yqaty.EncodeInt(e, "Level", x.Level)
+	rpc_yqaty.EncodeFloat(e, "Ratio", x.Ratio)
+	rpc_yqaty.EncodeBool(e, "Active", x.Active)
+	e.Value("Tags", &x.Tags)
+	e.Value("Timeout", &x.Timeout)
+	e.Value("Next", &x.Next)
+}
+
+func (x Record) MarshalRPC() ([]byte, error) {
+	return rpc_yqaty.MarshalObject(x)
+}
+
+func (x *Record) DecodeRPC(d *rpc_yqaty.ObjectDecoder) {
+	for d.Next() {
+		switch d.Key() {
+		case "ID":
+			rpc_yqaty.DecodeUint(d, &x.Base.ID)
+		case "Created":
+			rpc_yqaty.DecodeTime(d, &x.Base.Created)
+		case "Labels":
+			rpc_yqaty.DecodeMap(d, &rpc_yqaty.Alloc(&x.Meta).Labels, func(d *rpc_yqaty.ObjectDecoder, p *string) {
+				rpc_yqaty.DecodeString(d, p)
+			})
+		case "Score":
+			rpc_yqaty.DecodeFloat(d, &rpc_yqaty.Alloc(&x.Meta).Score)
+		case "Editor":
+			rpc_yqaty.DecodeString(d, &x.audit.Editor)
+		case "Name":
+			rpc_yqaty.DecodeString(d, &x.Name)
+		case "Level":
+			rpc_yqaty.DecodeInt(d, &x.Level)
+		case "Ratio":
+			rpc_yqaty.DecodeFloat(d, &x.Ratio)
+		case "Active":
+			rpc_yqaty.DecodeBool(d, &x.Active)
+		case "Tags":
+			rpc_yqaty.DecodeSlice(d, &x.Tags, func(d *rpc_yqaty.ObjectDecoder, p *string) {
+				rpc_yqaty.DecodeString(d, p)
+			})
+		case "Timeout":
+			rpc_yqaty.DecodeDuration(d, &x.Timeout)
+		case "Next":
+			rpc_yqaty.DecodePointer(d, &x.Next, func(d *rpc_yqaty.ObjectDecoder, p *Record) {
+				rpc_yqaty.DecodeObject(d, p)
+			})
+		default:
+			d.Skip()
+		}
+	}
+}
+
+func (x *Record) UnmarshalRPC(data []byte) error {
+	return rpc_yqaty.UnmarshalObject(data, x)
+}
+
+func (x Page) EncodeRPC(e *rpc_yqaty.ObjectEncoder) {
+	e.Value("Records", &x.Records)
+	rpc_yqaty.EncodeString(e, "Cursor", x.Cursor)
+	rpc_yqaty.EncodeInt(e, "Total", x.Total)
+}
+
+func (x Page) MarshalRPC() ([]byte, error) {
+	return rpc_yqaty.MarshalObject(x)
+}
+
+func (x *Page) DecodeRPC(d *rpc_yqaty.ObjectDecoder) {
+	for d.Next() {
+		switch d.Key() {
+		case "Records":
+			rpc_yqaty.DecodeSlice(d, &x.Records, func(d *rpc_yqaty.ObjectDecoder, p *Record) {
+				rpc_yqaty.DecodeObject(d, p)
+			})
+		case "Cursor":
+			rpc_yqaty.DecodeString(d, &x.Cursor)
+		case "Total":
+			rpc_yqaty.DecodeInt(d, &x.Total)
+		default:
+			d.Skip()
+		}
+	}
+}
+
+func (x *Page) UnmarshalRPC(data []byte) error {
+	return rpc_yqaty.UnmarshalObject(data, x)
+}
@@ -0,0 +1,112 @@
+package sample
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"rpc_yqaty/rpc_yqaty"
+)
+
+type plainRecord Record
+
+func record() Record {
+	return Record{
+		Base:    Base{ID: 1 << 63, Created: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)},
+		Meta:    &Meta{Labels: map[string]string{"b": "2", "a": "1"}, Score: 0.1},
+		audit:   audit{Editor: "ed"},
+		Name:    "line\n\"quoted\"",
+		Level:   -3,
+		Ratio:   1e-7,
+		Active:  true,
+		Tags:    []string{"x", "y"},
+		Timeout: 1500 * time.Millisecond,
+		Next:    &Record{Name: "next"},
+		secret:  "hidden",
+	}
+}
+
+func TestGenerated(t *testing.T) {
+	for _, r := range []Record{record(), {}} {
+		generated, err := rpc_yqaty.Marshal(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reflected, err := rpc_yqaty.Marshal(plainRecord(r))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if generated != reflected {
+			t.Errorf("generated encoding differs:\n%s\n%s", generated, reflected)
+		}
+
+		var a Record
+		var b plainRecord
+		if err := rpc_yqaty.UnMarshal(generated, &a); err != nil {
+			t.Fatal(err)
+		}
+		if err := rpc_yqaty.UnMarshal(generated, &b); err != nil {
+			t.Fatal(err)
+		}
+		r.secret = ""
+		if !reflect.DeepEqual(a, r) || !reflect.DeepEqual(Record(b), r) {
+			t.Errorf("round trip mismatch:\n%+v\n%+v\n%+v", r, a, b)
+		}
+	}
+
+	var page Page
+	input := `{"Total":"2","Unknown":[1,{"x":null}],"Records":[{"Name":"a","Level":1},null],"Cursor":null}`
+	if err := rpc_yqaty.UnMarshal(input, &page); err != nil {
+		t.Fatal(err)
+	}
+	if page.Total != 2 || len(page.Records) != 2 || page.Records[0].Name != "a" || page.Records[0].Level != 1 || page.Cursor != "" {
+		t.Errorf("unexpected page %+v", page)
+	}
+	var r Record
+	input = `{"Tags":null,"Labels":{"k":"v"},"Next":{"Next":null,"Tags":[]},"Timeout":"2s","Created":null}`
+	if err := rpc_yqaty.UnMarshal(input, &r); err != nil {
+		t.Fatal(err)
+	}
+	if r.Tags != nil || r.Labels["k"] != "v" || r.Next == nil || r.Next.Next != nil || r.Next.Tags == nil || r.Timeout != 2*time.Second {
+		t.Errorf("unexpected record %+v", r)
+	}
+	for _, input := range []string{`{"Level":128}`, `{"Name":1}`, `{"Active":"yes"}`, `[]`, `{"Ratio":NaN}`, `{"Level":+1}`, `{"ID":0x10}`, `{"Tags":[1]}`, `{"Tags":["a" "b"]}`, `{"Labels":{"a":1}}`, `{"Next":[]}`, `{"Timeout":1e3}`} {
+		if err := rpc_yqaty.UnMarshal(input, &r); err == nil {
+			t.Errorf("%s: expect an error", input)
+		}
+	}
+}
+
+func BenchmarkMarshal(b *testing.B) {
+	r := record()
+	b.Run("generated", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			rpc_yqaty.Marshal(r)
+		}
+	})
+	b.Run("reflect", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			rpc_yqaty.Marshal(plainRecord(r))
+		}
+	})
+}
+
+func BenchmarkUnmarshal(b *testing.B) {
+	s, _ := rpc_yqaty.Marshal(record())
+	b.Run("generated", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			var r Record
+			rpc_yqaty.UnMarshal(s, &r)
+		}
+	})
+	b.Run("reflect", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			var r plainRecord
+			rpc_yqaty.UnMarshal(s, &r)
+		}
+	})
+}
@@ -0,0 +1,394 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/format"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	annotation  = "//rpcgen:codec"
+	runtimePath = "rpc_yqaty/rpc_yqaty"
+)
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("rpcgen: ")
+	output := flag.String("output", "", "output file, default <file>_rpc.go")
+	flag.Parse()
+	file := os.Getenv("GOFILE")
+	if flag.NArg() > 0 {
+		file = flag.Arg(0)
+	}
+	if file == "" {
+		log.Fatal("no input file, run rpcgen with go generate or pass a file")
+	}
+	if *output == "" {
+		*output = strings.TrimSuffix(file, ".go") + "_rpc.go"
+	}
+	src, err := generate(file, *output)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := os.WriteFile(*output, src, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+type field struct {
+	name   string
+	index  []int
+	path   []string
+	ptrs   []bool
+	typ    types.Type
+	guards []string
+}
+
+type generator struct {
+	pkg       *types.Package
+	annotated map[types.Type]bool
+	qualifier string
+	buf       bytes.Buffer
+}
+
+func generate(file string, output string) ([]byte, error) {
+	dir := filepath.Dir(file)
+	bp, err := build.ImportDir(dir, 0)
+	if err != nil {
+		return nil, err
+	}
+	fset := token.NewFileSet()
+	var files []*ast.File
+	var target *ast.File
+	for _, name := range bp.GoFiles {
+		if name == filepath.Base(output) {
+			continue
+		}
+		f, err := parser.ParseFile(fset, filepath.Join(dir, name), nil, parser.ParseComments)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+		if name == filepath.Base(file) {
+			target = f
+		}
+	}
+	if target == nil {
+		return nil, errors.New(file + " is not part of the package in " + dir)
+	}
+	conf := types.Config{Importer: importer.ForCompiler(fset, "source", nil), Error: func(error) {}}
+	pkg, _ := conf.Check(bp.ImportPath, fset, files, nil)
+	if pkg == nil {
+		return nil, errors.New("can not type-check " + dir)
+	}
+
+	g := &generator{pkg: pkg, annotated: make(map[types.Type]bool), qualifier: "rpc_yqaty."}
+	if pkg.Path() == runtimePath {
+		g.qualifier = ""
+	}
+	var names []string
+	for _, f := range files {
+		for _, name := range annotatedTypes(f) {
+			obj := pkg.Scope().Lookup(name)
+			if obj == nil {
+				return nil, errors.New("type " + name + " not found")
+			}
+			g.annotated[obj.Type()] = true
+			if f == target {
+				names = append(names, name)
+			}
+		}
+	}
+	if len(names) == 0 {
+		return nil, errors.New("no " + annotation + " types in " + file)
+	}
+
+	fmt.Fprintf(&g.buf, "// Code generated by rpcgen; DO NOT EDIT.\n\npackage %s\n\n", pkg.Name())
+	if g.qualifier != "" {
+		fmt.Fprintf(&g.buf, "import %q\n", runtimePath)
+	}
+	for _, name := range names {
+		if err := g.generateType(pkg.Scope().Lookup(name).Type().(*types.Named)); err != nil {
+			return nil, err
+		}
+	}
+	src, err := format.Source(g.buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("invalid generated code: %v", err)
+	}
+	return src, nil
+}
+
+func annotatedTypes(f *ast.File) []string {
+	var names []string
+	for _, decl := range f.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.TYPE {
+			continue
+		}
+		for _, spec := range gen.Specs {
+			ts := spec.(*ast.TypeSpec)
+			doc := ts.Doc
+			if doc == nil && len(gen.Specs) == 1 {
+				doc = gen.Doc
+			}
+			if doc == nil {
+				continue
+			}
+			for _, c := range doc.List {
+				if strings.TrimSpace(c.Text) == annotation {
+					names = append(names, ts.Name.Name)
+					break
+				}
+			}
+		}
+	}
+	return names
+}
+
+func hasMethod(t types.Type, names ...string) bool {
+	for _, typ := range []types.Type{t, types.NewPointer(t)} {
+		mset := types.NewMethodSet(typ)
+		for _, name := range names {
+			if mset.Lookup(nil, name) != nil {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (g *generator) marshaler(t types.Type) bool {
+	return g.annotated[t] || hasMethod(t, "EncodeRPC", "MarshalRPC", "MarshalJSON", "MarshalText")
+}
+
+func (g *generator) custom(t types.Type) bool {
+	if named, ok := t.(*types.Named); ok && named.Obj().Pkg() != nil {
+		switch named.Obj().Pkg().Path() + "." + named.Obj().Name() {
+		case "time.Time", "time.Duration", "encoding/json.Number":
+			return true
+		}
+	}
+	return g.marshaler(t) || hasMethod(t, "DecodeRPC", "UnmarshalRPC", "UnmarshalJSON", "UnmarshalText")
+}
+
+func (g *generator) fields(t types.Type) []field {
+	type embedded struct {
+		typ   types.Type
+		index []int
+		path  []string
+		ptrs  []bool
+	}
+	var list []field
+	taken := make(map[string]bool)
+	visited := make(map[types.Type]bool)
+	next := []embedded{{typ: t}}
+	for len(next) > 0 {
+		current := next
+		next = nil
+		var level []field
+		count := make(map[string]int)
+		for _, e := range current {
+			if visited[e.typ] {
+				continue
+			}
+			visited[e.typ] = true
+			st := e.typ.Underlying().(*types.Struct)
+			for i := 0; i < st.NumFields(); i++ {
+				sf := st.Field(i)
+				index := append(append([]int{}, e.index...), i)
+				ft := sf.Type()
+				ptr, ok := ft.Underlying().(*types.Pointer)
+				if ok {
+					ft = ptr.Elem()
+				}
+				if _, isStruct := ft.Underlying().(*types.Struct); sf.Anonymous() && isStruct && (!sf.Exported() || !g.marshaler(ft)) {
+					next = append(next, embedded{
+						typ:   ft,
+						index: index,
+						path:  append(append([]string{}, e.path...), sf.Name()),
+						ptrs:  append(append([]bool{}, e.ptrs...), ok),
+					})
+					continue
+				}
+				if !sf.Exported() {
+					continue
+				}
+				level = append(level, field{name: sf.Name(), index: index, path: e.path, ptrs: e.ptrs, typ: sf.Type()})
+				count[sf.Name()]++
+			}
+		}
+		for _, f := range level {
+			if !taken[f.name] && count[f.name] == 1 {
+				list = append(list, f)
+			}
+		}
+		for name := range count {
+			taken[name] = true
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		a, b := list[i].index, list[j].index
+		for k := 0; k < len(a) && k < len(b); k++ {
+			if a[k] != b[k] {
+				return a[k] < b[k]
+			}
+		}
+		return len(a) < len(b)
+	})
+	for i := range list {
+		expr := "x"
+		for k, name := range list[i].path {
+			expr += "." + name
+			if list[i].ptrs[k] {
+				list[i].guards = append(list[i].guards, expr+" != nil")
+			}
+		}
+	}
+	return list
+}
+
+func (g *generator) kind(t types.Type) string {
+	if g.custom(t) {
+		return ""
+	}
+	basic, ok := t.Underlying().(*types.Basic)
+	if !ok {
+		return ""
+	}
+	info := basic.Info()
+	switch {
+	case info&types.IsString != 0:
+		return "String"
+	case info&types.IsBoolean != 0:
+		return "Bool"
+	case basic.Kind() == types.Uintptr:
+		return ""
+	case info&types.IsUnsigned != 0:
+		return "Uint"
+	case info&types.IsInteger != 0:
+		return "Int"
+	case info&types.IsFloat != 0:
+		return "Float"
+	}
+	return ""
+}
+
+func (g *generator) typeExpr(t types.Type) (string, bool) {
+	local := true
+	expr := types.TypeString(t, func(pkg *types.Package) string {
+		if pkg != g.pkg {
+			local = false
+		}
+		return ""
+	})
+	return expr, local
+}
+
+func (g *generator) decoder(t types.Type, target string) string {
+	q := g.qualifier
+	if kind := g.kind(t); kind != "" {
+		return fmt.Sprintf("%sDecode%s(d, %s)", q, kind, target)
+	}
+	if named, ok := t.(*types.Named); ok {
+		if named.Obj().Pkg() != nil && named.Obj().Pkg().Path() == "time" {
+			switch named.Obj().Name() {
+			case "Time", "Duration":
+				return fmt.Sprintf("%sDecode%s(d, %s)", q, named.Obj().Name(), target)
+			}
+		}
+		if g.annotated[t] {
+			return fmt.Sprintf("%sDecodeObject(d, %s)", q, target)
+		}
+		return "d.Value(" + target + ")"
+	}
+	var elem types.Type
+	var helper string
+	switch u := t.(type) {
+	case *types.Pointer:
+		elem, helper = u.Elem(), "DecodePointer"
+	case *types.Slice:
+		if basic, ok := u.Elem().Underlying().(*types.Basic); ok && basic.Kind() == types.Byte {
+			return "d.Value(" + target + ")"
+		}
+		elem, helper = u.Elem(), "DecodeSlice"
+	case *types.Map:
+		if basic, ok := u.Key().(*types.Basic); ok && basic.Kind() == types.String {
+			elem, helper = u.Elem(), "DecodeMap"
+		}
+	}
+	expr, ok := g.typeExpr(elem)
+	if elem == nil || !ok || g.custom(t) {
+		return "d.Value(" + target + ")"
+	}
+	return fmt.Sprintf("%s%s(d, %s, func(d *%sObjectDecoder, p *%s) {\n%s\n})", q, helper, target, q, expr, g.decoder(elem, "p"))
+}
+
+func (g *generator) generateType(named *types.Named) error {
+	name := named.Obj().Name()
+	if _, ok := named.Underlying().(*types.Struct); !ok {
+		return errors.New(name + " is not a struct")
+	}
+	if named.TypeParams().Len() > 0 {
+		return errors.New(name + ": generic types are not supported")
+	}
+	if hasMethod(named, "EncodeRPC", "DecodeRPC", "MarshalRPC", "UnmarshalRPC") {
+		return errors.New(name + " already has rpc encoding methods")
+	}
+	fields := g.fields(named)
+	q := g.qualifier
+
+	fmt.Fprintf(&g.buf, "\nfunc (x %s) EncodeRPC(e *%sObjectEncoder) {\n", name, q)
+	var open []string
+	for _, f := range fields {
+		guard := strings.Join(f.guards, " && ")
+		if strings.Join(open, " && ") != guard {
+			if len(open) > 0 {
+				g.buf.WriteString("}\n")
+			}
+			if open = f.guards; guard != "" {
+				fmt.Fprintf(&g.buf, "if %s {\n", guard)
+			}
+		}
+		access := strings.Join(append(append([]string{"x"}, f.path...), f.name), ".")
+		if kind := g.kind(f.typ); kind != "" {
+			fmt.Fprintf(&g.buf, "\t%sEncode%s(e, %q, %s)\n", q, kind, f.name, access)
+		} else {
+			fmt.Fprintf(&g.buf, "\te.Value(%q, &%s)\n", f.name, access)
+		}
+	}
+	if len(open) > 0 {
+		g.buf.WriteString("}\n")
+	}
+	g.buf.WriteString("}\n")
+	fmt.Fprintf(&g.buf, "\nfunc (x %s) MarshalRPC() ([]byte, error) {\n\treturn %sMarshalObject(x)\n}\n", name, q)
+
+	fmt.Fprintf(&g.buf, "\nfunc (x *%s) DecodeRPC(d *%sObjectDecoder) {\n\tfor d.Next() {\n\t\tswitch d.Key() {\n", name, q)
+	for _, f := range fields {
+		access := "x"
+		for k, p := range f.path {
+			access += "." + p
+			if f.ptrs[k] {
+				access = q + "Alloc(&" + access + ")"
+			}
+		}
+		access += "." + f.name
+		fmt.Fprintf(&g.buf, "\t\tcase %q:\n\t\t\t%s\n", f.name, g.decoder(f.typ, "&"+access))
+	}
+	g.buf.WriteString("\t\tdefault:\n\t\t\td.Skip()\n\t\t}\n\t}\n}\n")
+	fmt.Fprintf(&g.buf, "\nfunc (x *%s) UnmarshalRPC(data []byte) error {\n\treturn %sUnmarshalObject(data, x)\n}\n", name, q)
+	return nil
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+func TestGenerate(t *testing.T) {
+	src, err := generate("internal/sample/sample.go", "internal/sample/sample_rpc.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	current, err := os.ReadFile("internal/sample/sample_rpc.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(src, current) {
+		t.Errorf("internal/sample/sample_rpc.go is stale, run go generate:\n%s", src)
+	}
+	if _, err := generate("main.go", "main_rpc.go"); err == nil {
+		t.Errorf("expect an error for a file without annotated types")
+	}
+}
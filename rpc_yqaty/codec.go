@@ -1,17 +1,22 @@
 package rpc_yqaty
 
 import (
-	"bytes"
+	"encoding/base64"
 	"errors"
 	"fmt"
+	"io"
+	"math"
 	"reflect"
+	"sort"
 	"strconv"
 	"strings"
 	"text/scanner"
+	"unicode/utf16"
+	"unicode/utf8"
 )
 
 type Encoder struct {
-	s *bytes.Buffer
+	s encodeWriter
 }
 
 func (codec *Encoder) JSONEncode(data any) error {
@@ -19,9 +24,16 @@ func (codec *Encoder) JSONEncode(data any) error {
 }
 
 func (codec *Encoder) encode(data reflect.Value) error {
+	if !data.IsValid() {
+		codec.s.WriteString("null")
+		return nil
+	}
 	if !data.CanInterface() {
 		return nil
 	}
+	if ok, err := codec.encodeHook(data); ok {
+		return err
+	}
 	switch data.Kind() {
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
 		fmt.Fprintf(codec.s, "%d", data.Int())
@@ -32,18 +44,21 @@ func (codec *Encoder) encode(data reflect.Value) error {
 		return nil
 
 	case reflect.Float32, reflect.Float64:
-		fmt.Fprintf(codec.s, "%f", data.Float())
-		return nil
+		return codec.writeFloat(data.Float(), data.Type().Bits())
 
 	case reflect.Bool:
 		fmt.Fprintf(codec.s, "%t", data.Bool())
 		return nil
 
 	case reflect.Array, reflect.Slice:
-		if data.IsZero() {
+		if data.Kind() == reflect.Slice && data.IsNil() {
 			codec.s.WriteString("null")
 			return nil
 		}
+		if data.Kind() == reflect.Slice && data.Type().Elem().Kind() == reflect.Uint8 {
+			codec.writeString(base64.StdEncoding.EncodeToString(data.Bytes()))
+			return nil
+		}
 		codec.s.WriteString("[")
 		for i := 0; i < data.Len(); i++ {
 			if i > 0 {
@@ -61,23 +76,29 @@ func (codec *Encoder) encode(data reflect.Value) error {
 			codec.s.WriteString("null")
 			return nil
 		}
-		keys := data.MapKeys()
+		type entry struct {
+			key   string
+			value reflect.Value
+		}
+		entries := make([]entry, 0, data.Len())
+		for iter := data.MapRange(); iter.Next(); {
+			key, err := mapKey(iter.Key())
+			if err != nil {
+				return err
+			}
+			entries = append(entries, entry{key, iter.Value()})
+		}
+		sort.Slice(entries, func(i, j int) bool {
+			return entries[i].key < entries[j].key
+		})
 		codec.s.WriteString("{")
-		for i, key := range keys {
+		for i, e := range entries {
 			if i > 0 {
 				codec.s.WriteString(",")
 			}
-			if key.Kind() != reflect.String {
-				codec.s.WriteString("\"")
-			}
-			if err := codec.encode(key); err != nil {
-				return err
-			}
-			if key.Kind() != reflect.String {
-				codec.s.WriteString("\"")
-			}
+			codec.writeString(e.key)
 			codec.s.WriteString(":")
-			if err := codec.encode(data.MapIndex(key)); err != nil {
+			if err := codec.encode(e.value); err != nil {
 				return err
 			}
 		}
@@ -85,15 +106,11 @@ func (codec *Encoder) encode(data reflect.Value) error {
 		return nil
 
 	case reflect.String:
-		if data.IsZero() {
-			codec.s.WriteString("null")
-			return nil
-		}
-		fmt.Fprintf(codec.s, "\"%s\"", data.String())
+		codec.writeString(data.String())
 		return nil
 
 	case reflect.Pointer, reflect.Interface:
-		if data.IsZero() {
+		if data.IsNil() {
 			codec.s.WriteString("null")
 			return nil
 		}
@@ -105,16 +122,17 @@ func (codec *Encoder) encode(data reflect.Value) error {
 	case reflect.Struct:
 		codec.s.WriteString("{")
 		flag := true
-		for i := 0; i < data.NumField(); i++ {
-			if !data.Field(i).CanInterface() {
+		for _, f := range cachedFields(data.Type()).list {
+			v, ok := fieldByIndex(data, f.index, false)
+			if !ok {
 				continue
 			}
 			if !flag {
 				codec.s.WriteString(",")
 			}
 			flag = false
-			fmt.Fprintf(codec.s, "\"%s\":", data.Type().Field(i).Name)
-			if err := codec.encode(data.Field(i)); err != nil {
+			fmt.Fprintf(codec.s, "\"%s\":", f.name)
+			if err := codec.encode(v); err != nil {
 				return err
 			}
 		}
@@ -126,44 +144,280 @@ func (codec *Encoder) encode(data reflect.Value) error {
 	}
 }
 
+func (codec *Encoder) writeString(str string) {
+	codec.s.WriteByte('"')
+	for _, r := range str {
+		switch r {
+		case '"':
+			codec.s.WriteString("\\\"")
+		case '\\':
+			codec.s.WriteString("\\\\")
+		case '\n':
+			codec.s.WriteString("\\n")
+		case '\r':
+			codec.s.WriteString("\\r")
+		case '\t':
+			codec.s.WriteString("\\t")
+		default:
+			if r < 0x20 {
+				fmt.Fprintf(codec.s, "\\u%04x", r)
+			} else {
+				codec.s.WriteRune(r)
+			}
+		}
+	}
+	codec.s.WriteByte('"')
+}
+
+func (codec *Encoder) writeFloat(f float64, bits int) error {
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		return fmt.Errorf("unsupported float value: %v", f)
+	}
+	format := byte('f')
+	if abs := math.Abs(f); abs != 0 {
+		if bits == 64 && (abs < 1e-6 || abs >= 1e21) || bits == 32 && (float32(abs) < 1e-6 || float32(abs) >= 1e21) {
+			format = 'e'
+		}
+	}
+	b := strconv.AppendFloat(nil, f, format, -1, bits)
+	if format == 'e' {
+		if n := len(b); n >= 4 && b[n-4] == 'e' && b[n-3] == '-' && b[n-2] == '0' {
+			b[n-2] = b[n-1]
+			b = b[:n-1]
+		}
+	}
+	codec.s.Write(b)
+	return nil
+}
+
+var errInvalidString = errors.New("decode failed: invalid string literal")
+
+func unquote(str string) (string, error) {
+	if len(str) < 2 || str[0] != '"' || str[len(str)-1] != '"' {
+		return "", errInvalidString
+	}
+	str = str[1 : len(str)-1]
+	if !strings.ContainsAny(str, "\\\"") {
+		return str, nil
+	}
+	var b strings.Builder
+	b.Grow(len(str))
+	for i := 0; i < len(str); i++ {
+		c := str[i]
+		if c == '"' {
+			return "", errInvalidString
+		}
+		if c != '\\' {
+			b.WriteByte(c)
+			continue
+		}
+		if i++; i >= len(str) {
+			return "", errInvalidString
+		}
+		switch str[i] {
+		case '"', '\\', '/':
+			b.WriteByte(str[i])
+		case 'b':
+			b.WriteByte('\b')
+		case 'f':
+			b.WriteByte('\f')
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case 't':
+			b.WriteByte('\t')
+		case 'u':
+			r, ok := unquoteHex(str[i+1:])
+			if !ok {
+				return "", errInvalidString
+			}
+			i += 4
+			if utf16.IsSurrogate(r) {
+				low, ok := rune(0), false
+				if strings.HasPrefix(str[i+1:], "\\u") {
+					low, ok = unquoteHex(str[i+3:])
+				}
+				if dec := utf16.DecodeRune(r, low); ok && dec != utf8.RuneError {
+					r = dec
+					i += 6
+				} else {
+					r = utf8.RuneError
+				}
+			}
+			b.WriteRune(r)
+		default:
+			return "", errInvalidString
+		}
+	}
+	return b.String(), nil
+}
+
+func unquoteHex(s string) (rune, bool) {
+	if len(s) < 4 {
+		return 0, false
+	}
+	n, err := strconv.ParseUint(s[:4], 16, 32)
+	return rune(n), err == nil
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func validNumber(s string) bool {
+	i := 0
+	if i < len(s) && s[i] == '-' {
+		i++
+	}
+	switch {
+	case i < len(s) && s[i] == '0':
+		i++
+	case i < len(s) && s[i] >= '1' && s[i] <= '9':
+		for i < len(s) && isDigit(s[i]) {
+			i++
+		}
+	default:
+		return false
+	}
+	if i < len(s) && s[i] == '.' {
+		if i++; i == len(s) || !isDigit(s[i]) {
+			return false
+		}
+		for i < len(s) && isDigit(s[i]) {
+			i++
+		}
+	}
+	if i < len(s) && (s[i] == 'e' || s[i] == 'E') {
+		if i++; i < len(s) && (s[i] == '+' || s[i] == '-') {
+			i++
+		}
+		if i == len(s) || !isDigit(s[i]) {
+			return false
+		}
+		for i < len(s) && isDigit(s[i]) {
+			i++
+		}
+	}
+	return i == len(s)
+}
+
+func checkNumber(s string) error {
+	if !validNumber(s) {
+		return errors.New("decode failed: invalid number " + strconv.Quote(s))
+	}
+	return nil
+}
+
 type Decoder struct {
-	s *scanner.Scanner
+	s         *scanner.Scanner
+	tokens    []string
+	limits    DecodeLimits
+	reader    *limitedReader
+	depth     int
+	err       error
+	useNumber bool
 }
 
 func (codec *Decoder) consume(s string) error {
-	token := codec.s.Scan()
-	if token == scanner.EOF {
-		return errors.New("decode failed")
+	str, err := codec.Read()
+	if err != nil {
+		return err
 	}
-	str := codec.s.TokenText()
 	if str != s {
 		return errors.New("decode failed")
 	}
 	return nil
 }
 
+func (codec *Decoder) unread(str string) {
+	codec.tokens = append(codec.tokens, str)
+}
+
+func (codec *Decoder) readRaw() (string, error) {
+	var raw strings.Builder
+	depth := 0
+	for {
+		str, err := codec.Read()
+		if err != nil {
+			return "", err
+		}
+		raw.WriteString(str)
+		switch str {
+		case "{", "[":
+			if depth++; codec.limits.MaxDepth > 0 && codec.depth+depth > codec.limits.MaxDepth {
+				return "", codec.fail(errTooDeep)
+			}
+		case "}", "]":
+			depth--
+		}
+		if depth <= 0 {
+			return raw.String(), nil
+		}
+	}
+}
+
 func (codec *Decoder) JSONDecode(data any) error {
+	if data == nil {
+		_, err := codec.readRaw()
+		return err
+	}
 	vdata := reflect.ValueOf(data)
 	if vdata.Kind() != reflect.Pointer || vdata.IsNil() {
 		return errors.New("parameter must be a vaild pointer")
 	}
-	err := codec.decode(vdata)
-	return err
+	return codec.decodeSafe(vdata)
+}
+
+func (codec *Decoder) decodeSafe(data reflect.Value) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = codec.fail(fmt.Errorf("decode failed: %v", r))
+		}
+	}()
+	return codec.decode(data)
 }
 
 func (codec *Decoder) Read() (string, error) {
+	if codec.err != nil {
+		return "", codec.err
+	}
+	if n := len(codec.tokens); n > 0 {
+		str := codec.tokens[n-1]
+		codec.tokens = codec.tokens[:n-1]
+		return str, nil
+	}
 	token := codec.s.Scan()
 	if token == scanner.EOF {
-		return "", errors.New("decode failed")
+		return "", codec.eof()
 	}
 	str := codec.s.TokenText()
+	if str == "-" {
+		if codec.s.Scan() == scanner.EOF {
+			return "", codec.eof()
+		}
+		str += codec.s.TokenText()
+	}
+	if codec.limits.MaxString > 0 && len(str) > codec.limits.MaxString {
+		return "", codec.fail(errStringTooLong)
+	}
 	return str, nil
 }
 
+func (codec *Decoder) eof() error {
+	if codec.reader != nil && codec.reader.exceeded {
+		return codec.fail(errMessageTooLarge)
+	}
+	return io.EOF
+}
+
 func (codec *Decoder) decode(data reflect.Value) error {
 	if !data.CanInterface() {
 		return nil
 	}
+	if ok, err := codec.decodeHook(data); ok {
+		return err
+	}
 	switch data.Kind() {
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
 		str, err := codec.Read()
@@ -176,11 +430,14 @@ func (codec *Decoder) decode(data reflect.Value) error {
 		if str[0] == '"' {
 			str = str[1 : len(str)-1]
 		}
-		i, err := strconv.Atoi(str)
+		if err := checkNumber(str); err != nil {
+			return err
+		}
+		i, err := strconv.ParseInt(str, 10, data.Type().Bits())
 		if err != nil {
 			return err
 		}
-		data.SetInt(int64(i))
+		data.SetInt(i)
 		return nil
 
 	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
@@ -194,11 +451,14 @@ func (codec *Decoder) decode(data reflect.Value) error {
 		if str[0] == '"' {
 			str = str[1 : len(str)-1]
 		}
-		i, err := strconv.Atoi(str)
+		if err := checkNumber(str); err != nil {
+			return err
+		}
+		i, err := strconv.ParseUint(str, 10, data.Type().Bits())
 		if err != nil {
 			return err
 		}
-		data.SetUint(uint64(i))
+		data.SetUint(i)
 		return nil
 
 	case reflect.Float32, reflect.Float64:
@@ -212,11 +472,14 @@ func (codec *Decoder) decode(data reflect.Value) error {
 		if str[0] == '"' {
 			str = str[1 : len(str)-1]
 		}
-		f, err := strconv.ParseFloat(str, 64)
+		if err := checkNumber(str); err != nil {
+			return err
+		}
+		f, err := strconv.ParseFloat(str, data.Type().Bits())
 		if err != nil {
 			return err
 		}
-		data.SetFloat(float64(f))
+		data.SetFloat(f)
 		return nil
 
 	case reflect.Bool:
@@ -248,18 +511,35 @@ func (codec *Decoder) decode(data reflect.Value) error {
 		if str != "[" {
 			return errors.New("decode failed")
 		}
-		for i := 0; i < data.Len(); i++ {
-			if i > 0 {
-				if err := codec.consume(","); err != nil {
-					return err
-				}
+		if err := codec.enter(); err != nil {
+			return err
+		}
+		defer codec.leave()
+		if str, err = codec.Read(); err != nil {
+			return err
+		}
+		if str != "]" {
+			codec.unread(str)
+		}
+		i := 0
+		for ; str != "]"; i++ {
+			if i < data.Len() {
+				err = codec.decode(data.Index(i))
+			} else {
+				_, err = codec.readRaw()
+			}
+			if err != nil {
+				return err
 			}
-			if err := codec.decode(data.Index(i)); err != nil {
+			if str, err = codec.Read(); err != nil {
 				return err
 			}
+			if str != "," && str != "]" {
+				return errors.New("decode failed")
+			}
 		}
-		if err := codec.consume("]"); err != nil {
-			return err
+		for ; i < data.Len(); i++ {
+			data.Index(i).Set(reflect.Zero(data.Type().Elem()))
 		}
 		return nil
 
@@ -269,28 +549,52 @@ func (codec *Decoder) decode(data reflect.Value) error {
 			return err
 		}
 		if str == "null" {
+			data.Set(reflect.Zero(data.Type()))
+			return nil
+		}
+		if str[0] == '"' && data.Type().Elem().Kind() == reflect.Uint8 {
+			s, err := unquote(str)
+			if err != nil {
+				return err
+			}
+			b, err := base64.StdEncoding.DecodeString(s)
+			if err != nil {
+				return err
+			}
+			data.SetBytes(b)
 			return nil
 		}
 		if str != "[" {
 			return errors.New("decode failed")
 		}
-		cnt := 0
+		if err := codec.enter(); err != nil {
+			return err
+		}
+		defer codec.leave()
+		slice := reflect.MakeSlice(data.Type(), 0, 0)
+		if str, err = codec.Read(); err != nil {
+			return err
+		}
+		if str != "]" {
+			codec.unread(str)
+		}
 		for str != "]" {
+			if codec.limits.MaxCollection > 0 && slice.Len() >= codec.limits.MaxCollection {
+				return codec.fail(errCollectionTooLong)
+			}
 			val := reflect.New(data.Type().Elem()).Elem()
-			err := codec.decode(val)
-			if err != nil {
+			if err := codec.decode(val); err != nil {
 				return err
 			}
-			data.Index(cnt).Set(val)
-			str, err = codec.Read()
-			if err != nil {
+			slice = reflect.Append(slice, val)
+			if str, err = codec.Read(); err != nil {
 				return err
 			}
 			if str != "," && str != "]" {
 				return errors.New("decode failed")
 			}
-			cnt++
 		}
+		data.Set(slice)
 		return nil
 
 	case reflect.Map:
@@ -299,17 +603,45 @@ func (codec *Decoder) decode(data reflect.Value) error {
 			return err
 		}
 		if str == "null" {
+			if data.CanSet() {
+				data.Set(reflect.Zero(data.Type()))
+			}
 			return nil
 		}
 		if str != "{" {
 			return errors.New("decode failed")
 		}
+		if err := checkMapKey(data.Type().Key()); err != nil {
+			return err
+		}
+		if err := codec.enter(); err != nil {
+			return err
+		}
+		defer codec.leave()
+		if data.IsNil() {
+			if !data.CanSet() {
+				return errors.New("decode failed: nil map")
+			}
+			data.Set(reflect.MakeMap(data.Type()))
+		}
 		for str != "}" {
+			if str, err = codec.Read(); err != nil {
+				return err
+			}
+			if str == "}" {
+				break
+			}
+			if codec.limits.MaxCollection > 0 && data.Len() >= codec.limits.MaxCollection {
+				return codec.fail(errCollectionTooLong)
+			}
 			key := reflect.New(data.Type().Key()).Elem()
-			err := codec.decode(key)
+			name, err := unquote(str)
 			if err != nil {
 				return err
 			}
+			if err := setMapKey(key, name); err != nil {
+				return err
+			}
 			err = codec.consume(":")
 			if err != nil {
 				return err
@@ -335,13 +667,59 @@ func (codec *Decoder) decode(data reflect.Value) error {
 		if str == "null" {
 			return nil
 		}
-		data.SetString(str[1 : len(str)-1])
+		if str[0] != '"' {
+			return errors.New("decode failed")
+		}
+		s, err := unquote(str)
+		if err != nil {
+			return err
+		}
+		data.SetString(s)
 		return nil
 
-	case reflect.Pointer, reflect.Interface:
-		if err := codec.decode(data.Elem()); err != nil {
+	case reflect.Pointer:
+		str, err := codec.peek()
+		if err != nil {
+			return err
+		}
+		if str == "null" && data.CanSet() {
+			codec.Read()
+			data.Set(reflect.Zero(data.Type()))
+			return nil
+		}
+		if data.IsNil() {
+			if !data.CanSet() {
+				return errors.New("decode failed: nil pointer")
+			}
+			data.Set(reflect.New(data.Type().Elem()))
+		}
+		return codec.decode(data.Elem())
+
+	case reflect.Interface:
+		str, err := codec.peek()
+		if err != nil {
+			return err
+		}
+		if str == "null" && data.CanSet() {
+			codec.Read()
+			data.Set(reflect.Zero(data.Type()))
+			return nil
+		}
+		if !data.IsNil() && data.Elem().Kind() == reflect.Pointer && !data.Elem().IsNil() {
+			return codec.decode(data.Elem())
+		}
+		if data.NumMethod() != 0 || !data.CanSet() {
+			return fmt.Errorf("decode failed: can not decode into %v", data.Type())
+		}
+		v, err := codec.decodeAny()
+		if err != nil {
 			return err
 		}
+		if v == nil {
+			data.Set(reflect.Zero(data.Type()))
+		} else {
+			data.Set(reflect.ValueOf(v))
+		}
 		return nil
 
 	case reflect.Struct:
@@ -355,21 +733,35 @@ func (codec *Decoder) decode(data reflect.Value) error {
 		if str != "{" {
 			return errors.New("decode failed")
 		}
+		if err := codec.enter(); err != nil {
+			return err
+		}
+		defer codec.leave()
 		for str != "}" {
 			name, err := codec.Read()
 			if err != nil {
 				return err
 			}
-			name = name[1 : len(name)-1]
+			if name == "}" {
+				break
+			}
+			if name, err = unquote(name); err != nil {
+				return err
+			}
 			err = codec.consume(":")
 			if err != nil {
 				return err
 			}
-			_, bo := data.Type().FieldByName(name)
-			if bo {
-				if err := codec.decode(data.FieldByName(name)); err != nil {
+			var v reflect.Value
+			if f, ok := cachedFields(data.Type()).byName[name]; ok {
+				v, _ = fieldByIndex(data, f.index, true)
+			}
+			if v.IsValid() {
+				if err := codec.decode(v); err != nil {
 					return err
 				}
+			} else if _, err := codec.readRaw(); err != nil {
+				return err
 			}
 			str, err = codec.Read()
 			if err != nil {
@@ -384,13 +776,16 @@ func (codec *Decoder) decode(data reflect.Value) error {
 }
 
 func Marshal(arg any) (string, error) {
-	codec := &Encoder{new(bytes.Buffer)}
-	err := codec.JSONEncode(arg)
-	return codec.s.String(), err
+	buf := getBuffer()
+	defer putBuffer(buf)
+	err := (&Encoder{buf}).JSONEncode(arg)
+	return buf.String(), err
 }
 
 func UnMarshal(s string, rec any) error {
-	codec := &Decoder{new(scanner.Scanner)}
-	codec.s.Init(strings.NewReader(s))
-	return codec.JSONDecode(rec)
+	return unmarshalLimits(s, rec, DecodeLimits{})
+}
+
+func unmarshalLimits(s string, rec any, limits DecodeLimits) error {
+	return newDecoder(strings.NewReader(s), limits).JSONDecode(rec)
 }
@@ -1,8 +1,14 @@
 package rpc_yqaty
 
 import (
+	"encoding/json"
 	"fmt"
+	"math"
+	"math/big"
+	"net"
 	"reflect"
+	"strconv"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -279,6 +285,17 @@ func ServerTest() {
 	server.Accept("127.0.0.1:9090")
 }
 
+func serve(t testing.TB, server *Server) string {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { lis.Close() })
+	go server.Serve(lis)
+	return lis.Addr().String()
+}
+
 func call(t *testing.T, ans any, client *Client, name string, args any, reply any, wg *sync.WaitGroup) {
 	t.Helper()
 	defer wg.Done()
@@ -332,3 +349,322 @@ func TestAll(t *testing.T) {
 		fmt.Println(err)
 	}
 }
+
+func (f *Func) Total(A []Struct1, B *int) error {
+	for _, a := range A {
+		*B += a.A * a.B
+	}
+	return nil
+}
+
+func TestSlices(t *testing.T) {
+	tests := []struct {
+		input  string
+		data   any
+		output string
+	}{
+		{"[]", new([]int), "[]"},
+		{"[1,2,3]", new([]int), "[1,2,3]"},
+		{"[[1],[],[2,3]]", new([][]int), "[[1],[],[2,3]]"},
+		{"null", &[]int{1}, "null"},
+		{"\"aGVsbG8=\"", new([]byte), "\"aGVsbG8=\""},
+		{"[1]", new([3]int), "[1,0,0]"},
+		{"[1,2,3,4]", new([2]int), "[1,2]"},
+		{"[0,0]", new([2]int), "[0,0]"},
+		{"{\"Ar\":[4,5],\"As\":[]}", new(Struct4), "{\"A\":null,\"B\":{\"A\":0,\"B\":\"\",\"C\":0,\"D\":false},\"Mp\":null,\"Ar\":[4,5],\"As\":[]}"},
+	}
+	for _, test := range tests {
+		if err := UnMarshal(test.input, test.data); err != nil {
+			t.Errorf("UnMarshal %s: %v", test.input, err)
+			continue
+		}
+		if s, err := Marshal(test.data); s != test.output || err != nil {
+			t.Errorf("Marshal after UnMarshal %s: expect %s, output %s %v", test.input, test.output, s, err)
+		}
+	}
+
+	server := GetServer()
+	server.Register("total", (*Func).Total)
+	client := GetClient()
+	if err := client.Dial(serve(t, server)); err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	var reply int
+	if err := client.Call("total", []Struct1{{1, 2}, {3, 4}}, &reply); err != nil || reply != 14 {
+		t.Errorf("total: expect 14, output %v %v", reply, err)
+	}
+}
+
+func TestNumbers(t *testing.T) {
+	for _, test := range []struct {
+		data   any
+		output string
+	}{
+		{0.1, "0.1"},
+		{1234567.125, "1234567.125"},
+		{float32(0.1), "0.1"},
+		{1e21, "1e+21"},
+		{-1.5e-7, "-1.5e-7"},
+		{0.0, "0"},
+		{uint64(math.MaxUint64), "18446744073709551615"},
+		{int64(math.MinInt64), "-9223372036854775808"},
+	} {
+		s, err := Marshal(test.data)
+		if s != test.output || err != nil {
+			t.Errorf("Marshal %v: expect %s, output %s %v", test.data, test.output, s, err)
+			continue
+		}
+		back := reflect.New(reflect.TypeOf(test.data))
+		if err := UnMarshal(s, back.Interface()); err != nil || back.Elem().Interface() != test.data {
+			t.Errorf("UnMarshal %s: expect %v, output %v %v", s, test.data, back.Elem().Interface(), err)
+		}
+	}
+	for _, f := range []float64{math.NaN(), math.Inf(1)} {
+		if _, err := Marshal(f); err == nil {
+			t.Errorf("Marshal %v: expect an error", f)
+		}
+	}
+	for _, s := range []string{"0", "-0", "1.5e+10", "-0.25E-3", "123"} {
+		if !validNumber(s) {
+			t.Errorf("validNumber %s: expect a valid number", s)
+		}
+	}
+	for _, test := range []struct {
+		input string
+		data  any
+	}{
+		{"256", new(uint8)},
+		{"-129", new(int8)},
+		{"-1", new(uint64)},
+		{"18446744073709551616", new(uint64)},
+		{"1.5", new(int)},
+		{"NaN", new(float64)},
+		{"Inf", new(float64)},
+		{"-Infinity", new(float64)},
+		{"0x1p3", new(float64)},
+		{"+1", new(float64)},
+		{"+1", new(int)},
+		{"01", new(int)},
+		{"1.", new(float64)},
+		{".5", new(float64)},
+		{"1e", new(float64)},
+		{"\"NaN\"", new(float64)},
+		{"NaN", new(any)},
+		{"[1,+2]", new(any)},
+		{"0x10", new(any)},
+	} {
+		if err := UnMarshal(test.input, test.data); err == nil {
+			t.Errorf("UnMarshal %s into %T: expect an error", test.input, test.data)
+		}
+	}
+}
+
+func TestPointers(t *testing.T) {
+	A := &Struct4{}
+	if err := UnMarshal("{\"A\":{\"A\":1,\"B\":\"x\"},\"Mp\":{\"1\":\"a\"}}", A); err != nil || A.A == nil || A.A.A != 1 || A.A.B != "x" || A.Mp[1] != "a" {
+		t.Fatalf("expect a nil pointer and map to be allocated, output %+v %v", A, err)
+	}
+	if err := UnMarshal("{\"A\":null,\"Mp\":null}", A); err != nil || A.A != nil || A.Mp != nil {
+		t.Errorf("expect null to reset pointers and maps, output %+v %v", A, err)
+	}
+
+	var p **int
+	if err := UnMarshal("7", &p); err != nil || p == nil || **p != 7 {
+		t.Errorf("expect nested pointers to be allocated, output %v", err)
+	}
+
+	var v any
+	if err := UnMarshal("{\"a\":[1,\"b\",true,null,{}],\"c\":1.5}", &v); err != nil {
+		t.Fatal(err)
+	}
+	if s := fmt.Sprintf("%v", v); s != "map[a:[1 b true <nil> map[]] c:1.5]" {
+		t.Errorf("expect generic values, output %s", s)
+	}
+	decoder := newDecoder(strings.NewReader("[12345678901234567890]"), DecodeLimits{})
+	decoder.UseNumber()
+	if err := decoder.JSONDecode(&v); err != nil || v.([]any)[0] != json.Number("12345678901234567890") {
+		t.Errorf("expect a json.Number, output %#v %v", v, err)
+	}
+	if s, err := Marshal(v); s != "[12345678901234567890]" || err != nil {
+		t.Errorf("expect the number to be kept, output %s %v", s, err)
+	}
+	for _, n := range []json.Number{"NaN", "Inf", "0x1p3", "+1", "1_000"} {
+		if s, err := Marshal(n); err == nil {
+			t.Errorf("Marshal json.Number(%q): expect an error, output %s", n, s)
+		}
+		var back json.Number
+		if err := UnMarshal(strconv.Quote(string(n)), &back); err == nil {
+			t.Errorf("UnMarshal %q into json.Number: expect an error, output %s", n, back)
+		}
+	}
+
+	var reply int
+	v = &reply
+	if err := UnMarshal("3", &v); err != nil || reply != 3 {
+		t.Errorf("expect to decode into the pointer held by the interface, output %v %v", reply, err)
+	}
+}
+
+type UserID int
+
+func (id UserID) MarshalRPC() ([]byte, error) {
+	return []byte(fmt.Sprintf("\"u-%d\"", int(id))), nil
+}
+
+func (id *UserID) UnmarshalRPC(data []byte) error {
+	_, err := fmt.Sscanf(string(data), "\"u-%d\"", (*int)(id))
+	return err
+}
+
+type Record struct {
+	ID      UserID
+	At      time.Time
+	Timeout time.Duration
+	IP      net.IP
+	Balance *big.Int
+}
+
+func TestMarshalers(t *testing.T) {
+	at := time.Date(2024, 5, 6, 7, 8, 9, 500, time.UTC)
+	balance, _ := new(big.Int).SetString("123456789012345678901234567890", 10)
+	A := Record{ID: 42, At: at, Timeout: 1500 * time.Millisecond, IP: net.IPv4(10, 0, 0, 1), Balance: balance}
+	s, err := Marshal(A)
+	expect := "{\"ID\":\"u-42\",\"At\":\"2024-05-06T07:08:09.0000005Z\",\"Timeout\":1500000000,\"IP\":\"10.0.0.1\",\"Balance\":123456789012345678901234567890}"
+	if s != expect || err != nil {
+		t.Fatalf("Marshal: expect %s, output %s %v", expect, s, err)
+	}
+	var B Record
+	if err := UnMarshal(s, &B); err != nil {
+		t.Fatal(err)
+	}
+	if B.ID != A.ID || !B.At.Equal(at) || B.Timeout != A.Timeout || !B.IP.Equal(A.IP) || B.Balance.Cmp(balance) != 0 {
+		t.Errorf("UnMarshal: expect %+v, output %+v", A, B)
+	}
+	var d time.Duration
+	if err := UnMarshal("2000", &d); err != nil || d != 2*time.Microsecond {
+		t.Errorf("expect a duration from nanoseconds, output %v %v", d, err)
+	}
+	if err := UnMarshal("\"1.5s\"", &d); err != nil || d != A.Timeout {
+		t.Errorf("expect a duration from a duration string, output %v %v", d, err)
+	}
+	var raw RawMessage
+	if err := UnMarshal("{\"a\": [1, 2]}", &raw); err != nil || raw != "{\"a\":[1,2]}" {
+		t.Errorf("expect raw json, output %s %v", raw, err)
+	}
+}
+
+type Base struct {
+	ID   int
+	Name string
+}
+
+type Audit struct {
+	Name    string
+	Version int
+}
+
+type Entity struct {
+	Base
+	*Audit
+	Name string
+}
+
+type inner struct {
+	X int
+	Y string
+	z int
+}
+
+type hidden struct {
+	W int
+}
+
+type Outer struct {
+	inner
+	*hidden
+	Z int
+}
+
+type Ambiguous struct {
+	Base
+	Audit
+}
+
+func TestEmbedding(t *testing.T) {
+	A := Entity{Base: Base{ID: 1, Name: "base"}, Audit: &Audit{Name: "audit", Version: 2}, Name: "entity"}
+	s, err := Marshal(A)
+	if expect := "{\"ID\":1,\"Version\":2,\"Name\":\"entity\"}"; s != expect || err != nil {
+		t.Errorf("Marshal: expect %s, output %s %v", expect, s, err)
+	}
+	var B Entity
+	if err := UnMarshal(s, &B); err != nil || B.ID != 1 || B.Audit == nil || B.Version != 2 || B.Name != "entity" || B.Base.Name != "" {
+		t.Errorf("UnMarshal: expect promoted fields to be set, output %+v %v", B, err)
+	}
+	if s, err := Marshal(Entity{Name: "x"}); s != "{\"ID\":0,\"Name\":\"x\"}" || err != nil {
+		t.Errorf("Marshal: expect fields of a nil embedded pointer to be left out, output %s %v", s, err)
+	}
+	if s, err := Marshal(Ambiguous{Base{1, "a"}, Audit{"b", 2}}); s != "{\"ID\":1,\"Version\":2}" || err != nil {
+		t.Errorf("Marshal: expect conflicting fields to be dropped, output %s %v", s, err)
+	}
+	for _, outer := range []Outer{{inner{1, "a", 3}, nil, 2}, {inner{1, "a", 3}, &hidden{4}, 2}} {
+		s, err := Marshal(outer)
+		expect, _ := json.Marshal(outer)
+		if s != string(expect) || err != nil {
+			t.Errorf("Marshal: expect fields of unexported embedded structs like encoding/json %s, output %s %v", expect, s, err)
+		}
+	}
+	var C Outer
+	if err := UnMarshal("{\"X\":1,\"Y\":\"a\",\"Z\":2}", &C); err != nil || C.X != 1 || C.Y != "a" || C.Z != 2 {
+		t.Errorf("UnMarshal: expect promoted fields of an unexported embedded struct, output %+v %v", C, err)
+	}
+}
+
+type Point struct {
+	X, Y int
+}
+
+func (p Point) MarshalText() ([]byte, error) {
+	return []byte(fmt.Sprintf("%d:%d", p.X, p.Y)), nil
+}
+
+func (p *Point) UnmarshalText(text []byte) error {
+	_, err := fmt.Sscanf(string(text), "%d:%d", &p.X, &p.Y)
+	return err
+}
+
+func TestMapKeys(t *testing.T) {
+	A := map[string]int{"b": 2, "a": 1, "c": 3, "\"q\"": 4}
+	for i := 0; i < 10; i++ {
+		if s, err := Marshal(A); s != "{\"\\\"q\\\"\":4,\"a\":1,\"b\":2,\"c\":3}" || err != nil {
+			t.Fatalf("expect sorted keys, output %s %v", s, err)
+		}
+	}
+
+	B := map[int64]string{-5: "x", 10: "y", 2: "z"}
+	s, err := Marshal(B)
+	if s != "{\"-5\":\"x\",\"10\":\"y\",\"2\":\"z\"}" || err != nil {
+		t.Errorf("Marshal int keys: output %s %v", s, err)
+	}
+	var C map[int64]string
+	if err := UnMarshal(s, &C); err != nil || !reflect.DeepEqual(B, C) {
+		t.Errorf("UnMarshal int keys: expect %v, output %v %v", B, C, err)
+	}
+
+	D := map[Point]uint8{{1, 2}: 3, {0, 5}: 6}
+	if s, err = Marshal(D); s != "{\"0:5\":6,\"1:2\":3}" || err != nil {
+		t.Errorf("Marshal text keys: output %s %v", s, err)
+	}
+	var E map[Point]uint8
+	if err := UnMarshal(s, &E); err != nil || !reflect.DeepEqual(D, E) {
+		t.Errorf("UnMarshal text keys: expect %v, output %v %v", D, E, err)
+	}
+
+	if _, err := Marshal(map[float64]int{1.5: 1}); err == nil {
+		t.Errorf("Marshal float keys: expect an error")
+	}
+	var F map[[2]int]int
+	if err := UnMarshal("{\"1\":1}", &F); err == nil {
+		t.Errorf("UnMarshal array keys: expect an error")
+	}
+}
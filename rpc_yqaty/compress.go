@@ -0,0 +1,128 @@
+package rpc_yqaty
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"io"
+	"sync"
+)
+
+const DefaultCompressThreshold = 1024
+
+type Compressor interface {
+	Name() string
+	Compress(data []byte) ([]byte, error)
+	Decompress(data []byte, max int64) ([]byte, error)
+}
+
+type GzipCompressor struct{}
+
+func (GzipCompressor) Name() string {
+	return "gzip"
+}
+
+func (GzipCompressor) Compress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (GzipCompressor) Decompress(data []byte, max int64) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	if max <= 0 {
+		return io.ReadAll(r)
+	}
+	raw, err := io.ReadAll(io.LimitReader(r, max+1))
+	if err == nil && int64(len(raw)) > max {
+		return nil, errMessageTooLarge
+	}
+	return raw, err
+}
+
+var (
+	compressorMutex sync.RWMutex
+	compressors     = map[string]Compressor{"gzip": GzipCompressor{}}
+	compressorOrder = []string{"gzip"}
+)
+
+func RegisterCompressor(compressor Compressor) {
+	compressorMutex.Lock()
+	defer compressorMutex.Unlock()
+	if _, ok := compressors[compressor.Name()]; !ok {
+		compressorOrder = append(compressorOrder, compressor.Name())
+	}
+	compressors[compressor.Name()] = compressor
+}
+
+func lookupCompressor(name string) Compressor {
+	compressorMutex.RLock()
+	defer compressorMutex.RUnlock()
+	return compressors[name]
+}
+
+func compressorNames() []string {
+	compressorMutex.RLock()
+	defer compressorMutex.RUnlock()
+	return append([]string{}, compressorOrder...)
+}
+
+func encodeBody(buf *bytes.Buffer, data any, compressor Compressor, threshold int) ([]byte, string, error) {
+	if err := (&Encoder{buf}).JSONEncode(data); err != nil {
+		return nil, "", err
+	}
+	if threshold <= 0 {
+		threshold = DefaultCompressThreshold
+	}
+	if compressor == nil || buf.Len() < threshold {
+		return buf.Bytes(), "", nil
+	}
+	packed, err := compressor.Compress(buf.Bytes())
+	if err != nil {
+		return nil, "", err
+	}
+	if base64.StdEncoding.EncodedLen(len(packed)) >= buf.Len() {
+		return buf.Bytes(), "", nil
+	}
+	out := new(bytes.Buffer)
+	(&Encoder{out}).writeString(base64.StdEncoding.EncodeToString(packed))
+	return out.Bytes(), compressor.Name(), nil
+}
+
+func (codec *Decoder) decodeBody(compression string, data any) error {
+	if compression == "" || data == nil {
+		return codec.JSONDecode(data)
+	}
+	var packed string
+	if err := codec.JSONDecode(&packed); err != nil {
+		return err
+	}
+	compressor := lookupCompressor(compression)
+	if compressor == nil {
+		return &Error{Code: CodeUnimplemented, Message: "unknown compression " + compression}
+	}
+	raw, err := base64.StdEncoding.DecodeString(packed)
+	if err != nil {
+		return err
+	}
+	if raw, err = compressor.Decompress(raw, codec.limits.MaxMessageBytes); err != nil {
+		if err == errMessageTooLarge {
+			return codec.fail(err)
+		}
+		return err
+	}
+	if codec.limits.MaxMessageBytes > 0 && int64(len(raw)) > codec.limits.MaxMessageBytes {
+		return codec.fail(errMessageTooLarge)
+	}
+	return newDecoder(bytes.NewReader(raw), codec.limits).JSONDecode(data)
+}
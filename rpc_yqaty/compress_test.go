@@ -0,0 +1,80 @@
+package rpc_yqaty
+
+import (
+	"encoding/base64"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func (f *Func) Repeat(A Struct1, B *string) error {
+	*B = strings.Repeat("compressible ", A.A)
+	return nil
+}
+
+type countingConn struct {
+	net.Conn
+	read int64
+}
+
+func (conn *countingConn) Read(p []byte) (int, error) {
+	n, err := conn.Conn.Read(p)
+	atomic.AddInt64(&conn.read, int64(n))
+	return n, err
+}
+
+func TestCompression(t *testing.T) {
+	server := GetServer()
+	server.Register("repeat", (*Func).Repeat)
+	addr := serve(t, server)
+
+	read := make(map[string]int64)
+	for _, compression := range []string{"", "gzip"} {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		counter := &countingConn{Conn: conn}
+		client := GetClient()
+		client.Compression = splitList(compression)
+		client.InitCodec(counter)
+		if err := client.start(); err != nil {
+			t.Fatal(err)
+		}
+		if hello := client.Protocol(); hello.Compression != compression {
+			t.Errorf("expect compression %q, output %q", compression, hello.Compression)
+		}
+		for _, n := range []int{1, 1000} {
+			var reply string
+			if err := client.Call("repeat", Struct1{n, 0}, &reply); err != nil || reply != strings.Repeat("compressible ", n) {
+				t.Fatalf("%q: unexpected reply of length %v, %v", compression, len(reply), err)
+			}
+		}
+		read[compression] = atomic.LoadInt64(&counter.read)
+		client.Close()
+	}
+	if read["gzip"]*10 > read[""] {
+		t.Errorf("expect gzip to shrink the replies, read %v", read)
+	}
+}
+
+func TestDecompressLimit(t *testing.T) {
+	packed, err := GzipCompressor{}.Compress(make([]byte, 8<<20))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := (GzipCompressor{}).Decompress(packed, 1<<20); err != errMessageTooLarge {
+		t.Errorf("expect %v, output %v", errMessageTooLarge, err)
+	}
+	if raw, err := (GzipCompressor{}).Decompress(packed, 8<<20); err != nil || len(raw) != 8<<20 {
+		t.Errorf("expect %v bytes, output %v %v", 8<<20, len(raw), err)
+	}
+
+	body := `"` + base64.StdEncoding.EncodeToString(packed) + `" `
+	decoder := newDecoder(strings.NewReader(body), DecodeLimits{MaxMessageBytes: 1 << 20})
+	var out []byte
+	if err := decoder.decodeBody("gzip", &out); ErrorCode(err) != CodeResourceExhausted {
+		t.Errorf("expect code %v, output %v", CodeResourceExhausted, err)
+	}
+}
@@ -0,0 +1,103 @@
+package rpc_yqaty
+
+import (
+	"io"
+	"text/scanner"
+)
+
+type DecodeLimits struct {
+	MaxMessageBytes int64
+	MaxDepth        int
+	MaxCollection   int
+	MaxString       int
+}
+
+var DefaultDecodeLimits = DecodeLimits{
+	MaxMessageBytes: 16 << 20,
+	MaxDepth:        100,
+	MaxCollection:   1 << 20,
+	MaxString:       8 << 20,
+}
+
+var (
+	errMessageTooLarge   = &Error{Code: CodeResourceExhausted, Message: "decode: message too large"}
+	errTooDeep           = &Error{Code: CodeResourceExhausted, Message: "decode: nesting too deep"}
+	errCollectionTooLong = &Error{Code: CodeResourceExhausted, Message: "decode: collection too long"}
+	errStringTooLong     = &Error{Code: CodeResourceExhausted, Message: "decode: string too long"}
+)
+
+func (limits DecodeLimits) withDefaults() DecodeLimits {
+	if limits.MaxMessageBytes == 0 {
+		limits.MaxMessageBytes = DefaultDecodeLimits.MaxMessageBytes
+	}
+	if limits.MaxDepth == 0 {
+		limits.MaxDepth = DefaultDecodeLimits.MaxDepth
+	}
+	if limits.MaxCollection == 0 {
+		limits.MaxCollection = DefaultDecodeLimits.MaxCollection
+	}
+	if limits.MaxString == 0 {
+		limits.MaxString = DefaultDecodeLimits.MaxString
+	}
+	return limits
+}
+
+type limitedReader struct {
+	r        io.Reader
+	n        int64
+	max      int64
+	exceeded bool
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.max > 0 {
+		if l.n <= 0 {
+			l.exceeded = true
+			return 0, errMessageTooLarge
+		}
+		if int64(len(p)) > l.n {
+			p = p[:l.n]
+		}
+	}
+	n, err := l.r.Read(p)
+	l.n -= int64(n)
+	return n, err
+}
+
+func newDecoder(r io.Reader, limits DecodeLimits) *Decoder {
+	limits = limits.withDefaults()
+	reader := &limitedReader{r: r, n: limits.MaxMessageBytes, max: limits.MaxMessageBytes}
+	codec := &Decoder{s: new(scanner.Scanner), limits: limits, reader: reader}
+	codec.s.Init(reader)
+	codec.s.Error = func(s *scanner.Scanner, msg string) {}
+	return codec
+}
+
+func (codec *Decoder) begin() {
+	if codec.reader != nil {
+		codec.reader.n = codec.reader.max
+	}
+}
+
+func (codec *Decoder) fail(err error) error {
+	if codec.err == nil {
+		codec.err = err
+	}
+	return codec.err
+}
+
+func (codec *Decoder) Err() error {
+	return codec.err
+}
+
+func (codec *Decoder) enter() error {
+	codec.depth++
+	if codec.limits.MaxDepth > 0 && codec.depth > codec.limits.MaxDepth {
+		return codec.fail(errTooDeep)
+	}
+	return nil
+}
+
+func (codec *Decoder) leave() {
+	codec.depth--
+}
@@ -0,0 +1,82 @@
+package rpc_yqaty
+
+import (
+	"strings"
+	"testing"
+)
+
+func (f *Func) Panic(A Struct1, B *int) error {
+	var m map[int]int
+	m[A.A] = A.B
+	return nil
+}
+
+type limitedList struct {
+	Items []int
+	Next  *limitedList
+}
+
+func (l *limitedList) DecodeRPC(d *ObjectDecoder) {
+	for d.Next() {
+		switch d.Key() {
+		case "Items":
+			DecodeSlice(d, &l.Items, func(d *ObjectDecoder, p *int) {
+				DecodeInt(d, p)
+			})
+		case "Next":
+			DecodePointer(d, &l.Next, func(d *ObjectDecoder, p *limitedList) {
+				DecodeObject(d, p)
+			})
+		default:
+			d.Skip()
+		}
+	}
+}
+
+func TestDecodeLimits(t *testing.T) {
+	limits := DecodeLimits{MaxDepth: 3, MaxCollection: 2, MaxString: 8}
+	tests := []struct {
+		input string
+		data  any
+		err   error
+	}{
+		{`{"X":{"B":{"C":{"D":1}}}}`, new(Struct1), errTooDeep},
+		{`{"a":1,"b":2,"c":3}`, &map[string]int{}, errCollectionTooLong},
+		{`"a long string"`, new(string), errStringTooLong},
+		{`{"a":1,"b":2}`, &map[string]int{}, nil},
+		{`{"Items":[1,2,3]}`, new(limitedList), errCollectionTooLong},
+		{`{"Next":{"Next":{"Next":{}}}}`, new(limitedList), errTooDeep},
+		{`{"Items":[1,2],"Next":{"Items":null}}`, new(limitedList), nil},
+	}
+	for _, test := range tests {
+		if err := newDecoder(strings.NewReader(test.input), limits).JSONDecode(test.data); err != test.err {
+			t.Errorf("%v: expect %v, output %v", test.input, test.err, err)
+		}
+	}
+
+	server := GetServer()
+	server.Register("add", (*Func).Add)
+	server.Register("repeat", (*Func).Repeat)
+	server.Register("panic", (*Func).Panic)
+	server.Limits = DecodeLimits{MaxMessageBytes: 4096}
+	addr := serve(t, server)
+	client := GetClient()
+	if err := client.Dial(addr); err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	if err := client.Call("panic", Struct1{1, 2}, new(int)); ErrorCode(err) != CodeInternal {
+		t.Errorf("panic: expect code %v, output %v", CodeInternal, err)
+	}
+	if err := client.Call("add", Struct1{1, 2}, new(int)); err != nil {
+		t.Errorf("expect the connection to survive a panic, output %v", err)
+	}
+	type Big struct {
+		A int
+		B int
+		C string
+	}
+	if err := client.Call("add", Big{1, 2, strings.Repeat("x", 8192)}, new(int)); ErrorCode(err) != CodeResourceExhausted {
+		t.Errorf("expect code %v, output %v", CodeResourceExhausted, err)
+	}
+}
@@ -0,0 +1,78 @@
+package rpc_yqaty
+
+import (
+	"reflect"
+	"sync"
+	"time"
+)
+
+const DefaultMaxDedupEntries = 10000
+
+type dedupEntry struct {
+	key     string
+	done    chan struct{}
+	reply   reflect.Value
+	err     error
+	expires time.Time
+}
+
+type dedupCache struct {
+	mutex   sync.Mutex
+	entries map[string]*dedupEntry
+	order   []*dedupEntry
+}
+
+func (cache *dedupCache) prune(now time.Time, max int) {
+	for len(cache.order) > 0 {
+		entry := cache.order[0]
+		if entry.expires.After(now) && len(cache.order) <= max {
+			return
+		}
+		if cache.entries[entry.key] == entry {
+			delete(cache.entries, entry.key)
+		}
+		cache.order[0] = nil
+		cache.order = cache.order[1:]
+	}
+}
+
+func (cache *dedupCache) do(key string, window time.Duration, max int, fn func() (reflect.Value, error)) (reflect.Value, error) {
+	if max <= 0 {
+		max = DefaultMaxDedupEntries
+	}
+	cache.mutex.Lock()
+	if cache.entries == nil {
+		cache.entries = make(map[string]*dedupEntry)
+	}
+	cache.prune(time.Now(), max)
+	if entry, ok := cache.entries[key]; ok {
+		cache.mutex.Unlock()
+		<-entry.done
+		return entry.reply, entry.err
+	}
+	entry := &dedupEntry{key: key, done: make(chan struct{})}
+	cache.entries[key] = entry
+	cache.mutex.Unlock()
+
+	entry.reply, entry.err = fn()
+	cache.mutex.Lock()
+	if code := ErrorCode(entry.err); code == CodeUnavailable || code == CodeResourceExhausted {
+		delete(cache.entries, key)
+	} else {
+		entry.expires = time.Now().Add(window)
+		cache.order = append(cache.order, entry)
+		cache.prune(time.Now(), max)
+	}
+	cache.mutex.Unlock()
+	close(entry.done)
+	return entry.reply, entry.err
+}
+
+func (server *Server) invokeKey(name string, key string, method *MethodType, args reflect.Value) (reflect.Value, error) {
+	if server.DedupWindow <= 0 || key == "" {
+		return server.invokeCached(method, args)
+	}
+	return server.dedup.do(name+"\x00"+key, server.DedupWindow, server.MaxDedupEntries, func() (reflect.Value, error) {
+		return server.invokeCached(method, args)
+	})
+}
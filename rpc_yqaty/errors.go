@@ -0,0 +1,98 @@
+package rpc_yqaty
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type Code int
+
+const (
+	CodeOK Code = iota
+	CodeCanceled
+	CodeUnknown
+	CodeInvalidArgument
+	CodeDeadlineExceeded
+	CodeNotFound
+	CodeResourceExhausted
+	CodeUnavailable
+	CodeInternal
+	CodeUnimplemented
+	CodeUnauthenticated
+)
+
+var codeNames = []string{"OK", "Canceled", "Unknown", "InvalidArgument", "DeadlineExceeded", "NotFound", "ResourceExhausted", "Unavailable", "Internal", "Unimplemented", "Unauthenticated"}
+
+func (code Code) String() string {
+	if code < 0 || int(code) >= len(codeNames) {
+		return "Code(" + strconv.Itoa(int(code)) + ")"
+	}
+	return codeNames[code]
+}
+
+type Error struct {
+	Code       Code
+	Message    string
+	RetryAfter time.Duration
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+var (
+	errNotRegistered = &Error{Code: CodeNotFound, Message: "the name has not been register"}
+	errShutdown      = &Error{Code: CodeUnavailable, Message: "the connection is shut down"}
+	errTimeout       = &Error{Code: CodeDeadlineExceeded, Message: "TLE!"}
+)
+
+func ErrorCode(err error) Code {
+	if err == nil {
+		return CodeOK
+	}
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	return CodeUnknown
+}
+
+func errorResponse(seq uint64, err error) *Response {
+	resp := &Response{Seq: seq, Error: err.Error(), Code: ErrorCode(err)}
+	var e *Error
+	if errors.As(err, &e) {
+		resp.RetryAfter = e.RetryAfter.Milliseconds()
+	}
+	return resp
+}
+
+func responseError(resp *Response) error {
+	code := resp.Code
+	if code == CodeOK {
+		code = CodeUnknown
+	}
+	return &Error{Code: code, Message: resp.Error, RetryAfter: time.Duration(resp.RetryAfter) * time.Millisecond}
+}
+
+func httpStatus(err error) int {
+	switch ErrorCode(err) {
+	case CodeInvalidArgument:
+		return http.StatusBadRequest
+	case CodeNotFound:
+		return http.StatusNotFound
+	case CodeDeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case CodeResourceExhausted:
+		return http.StatusTooManyRequests
+	case CodeUnavailable:
+		return http.StatusServiceUnavailable
+	case CodeUnimplemented:
+		return http.StatusNotImplemented
+	case CodeUnauthenticated:
+		return http.StatusUnauthorized
+	default:
+		return http.StatusInternalServerError
+	}
+}
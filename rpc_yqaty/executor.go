@@ -0,0 +1,127 @@
+package rpc_yqaty
+
+import (
+	"sync"
+	"time"
+)
+
+const callTimeout = 5 * time.Second
+
+type Executor interface {
+	Execute(task func()) error
+}
+
+type GoExecutor struct{}
+
+func (GoExecutor) Execute(task func()) error {
+	go task()
+	return nil
+}
+
+type InlineExecutor struct{}
+
+func (InlineExecutor) Execute(task func()) error {
+	task()
+	return nil
+}
+
+type serialQueue struct {
+	mutex   sync.Mutex
+	tasks   []func()
+	running bool
+}
+
+func (queue *serialQueue) Execute(task func()) error {
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+	queue.tasks = append(queue.tasks, task)
+	if !queue.running {
+		queue.running = true
+		go queue.run()
+	}
+	return nil
+}
+
+func (queue *serialQueue) run() {
+	for {
+		queue.mutex.Lock()
+		if len(queue.tasks) == 0 {
+			queue.running = false
+			queue.mutex.Unlock()
+			return
+		}
+		task := queue.tasks[0]
+		queue.tasks[0] = nil
+		queue.tasks = queue.tasks[1:]
+		queue.mutex.Unlock()
+		task()
+	}
+}
+
+func (conn *serverConn) queue(name string) *serialQueue {
+	conn.mutex.Lock()
+	defer conn.mutex.Unlock()
+	queue := conn.queues[name]
+	if queue == nil {
+		queue = new(serialQueue)
+		conn.queues[name] = queue
+	}
+	return queue
+}
+
+type WorkerPool struct {
+	tasks  chan func()
+	wg     sync.WaitGroup
+	once   sync.Once
+	mutex  sync.RWMutex
+	closed bool
+}
+
+func NewWorkerPool(workers int, queue int) *WorkerPool {
+	pool := &WorkerPool{tasks: make(chan func(), queue)}
+	for i := 0; i < workers; i++ {
+		pool.wg.Add(1)
+		go func() {
+			defer pool.wg.Done()
+			for task := range pool.tasks {
+				task()
+			}
+		}()
+	}
+	return pool
+}
+
+func (pool *WorkerPool) Execute(task func()) error {
+	pool.mutex.RLock()
+	defer pool.mutex.RUnlock()
+	if pool.closed {
+		return &Error{Code: CodeUnavailable, Message: "the worker pool is closed"}
+	}
+	select {
+	case pool.tasks <- task:
+		return nil
+	default:
+		return &Error{Code: CodeResourceExhausted, Message: "the worker pool queue is full"}
+	}
+}
+
+func (pool *WorkerPool) Close() {
+	pool.once.Do(func() {
+		pool.mutex.Lock()
+		pool.closed = true
+		close(pool.tasks)
+		pool.mutex.Unlock()
+	})
+	pool.wg.Wait()
+}
+
+func (server *Server) executor(method *MethodType) Executor {
+	executor := method.Executor
+	if executor == nil {
+		executor = server.Executor
+	}
+	if _, ok := executor.(InlineExecutor); executor == nil || ok && method.streaming() {
+		return GoExecutor{}
+	}
+	return executor
+}
@@ -0,0 +1,73 @@
+package rpc_yqaty
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+var (
+	recordMutex sync.Mutex
+	records     []int
+)
+
+func (f *Func) Record(A Struct1, B *int) error {
+	time.Sleep(time.Duration(A.A%3) * time.Millisecond)
+	recordMutex.Lock()
+	records = append(records, A.A)
+	recordMutex.Unlock()
+	return nil
+}
+
+func TestExecutor(t *testing.T) {
+	records = nil
+	server := GetServer()
+	server.Register("record", (*Func).Record, Ordered())
+	server.Register("sleep", (*Func).Sleep)
+	server.Register("ordered-sleep", (*Func).Sleep, Ordered())
+	pool := NewWorkerPool(1, 0)
+	defer pool.Close()
+	server.Executor = pool
+	client := GetClient()
+	if err := client.Dial(serve(t, server)); err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	queries := make([]*Query, 20)
+	for i := range queries {
+		queries[i] = &Query{Method: "record", Args: Struct1{i, 0}, Reply: new(int), Done: make(chan *Query, 1)}
+		client.Deal(queries[i])
+	}
+	for _, query := range queries {
+		<-query.Done
+	}
+	for i, record := range records {
+		if record != i || len(records) != len(queries) {
+			t.Fatalf("record: expect ordered execution, output %v", records)
+		}
+	}
+
+	slow := &Query{Method: "ordered-sleep", Args: Struct1{300, 0}, Reply: new(int), Done: make(chan *Query, 1)}
+	client.Deal(slow)
+	time.Sleep(10 * time.Millisecond)
+	begin := time.Now()
+	if err := client.Call("sleep", Struct1{0, 1}, new(int)); err != nil || time.Since(begin) > 100*time.Millisecond {
+		t.Errorf("sleep: expect other methods to run beside an ordered call, took %v, %v", time.Since(begin), err)
+	}
+	<-slow.Done
+
+	errs := make([]error, 2)
+	wg := new(sync.WaitGroup)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = client.Call("sleep", Struct1{200, i}, new(int))
+		}(i)
+	}
+	wg.Wait()
+	if ErrorCode(errs[0]) != CodeResourceExhausted && ErrorCode(errs[1]) != CodeResourceExhausted {
+		t.Errorf("sleep: expect the full pool to reject a call, output %v %v", errs[0], errs[1])
+	}
+}
@@ -0,0 +1,105 @@
+package rpc_yqaty
+
+import (
+	"reflect"
+	"sort"
+	"sync"
+)
+
+type field struct {
+	name  string
+	index []int
+}
+
+type structFields struct {
+	list   []field
+	byName map[string]*field
+}
+
+var fieldCache sync.Map
+
+func cachedFields(t reflect.Type) *structFields {
+	if fields, ok := fieldCache.Load(t); ok {
+		return fields.(*structFields)
+	}
+	fields, _ := fieldCache.LoadOrStore(t, typeFields(t))
+	return fields.(*structFields)
+}
+
+func typeFields(t reflect.Type) *structFields {
+	type embedded struct {
+		typ   reflect.Type
+		index []int
+	}
+	var list []field
+	taken := make(map[string]bool)
+	visited := make(map[reflect.Type]bool)
+	next := []embedded{{typ: t}}
+	for len(next) > 0 {
+		current := next
+		next = nil
+		var level []field
+		count := make(map[string]int)
+		for _, e := range current {
+			if visited[e.typ] {
+				continue
+			}
+			visited[e.typ] = true
+			for i := 0; i < e.typ.NumField(); i++ {
+				sf := e.typ.Field(i)
+				index := append(append([]int{}, e.index...), i)
+				ft := sf.Type
+				if ft.Kind() == reflect.Pointer {
+					ft = ft.Elem()
+				}
+				if sf.Anonymous && ft.Kind() == reflect.Struct && (!sf.IsExported() || marshaler(reflect.New(ft).Elem()) == nil) {
+					next = append(next, embedded{typ: ft, index: index})
+					continue
+				}
+				if !sf.IsExported() {
+					continue
+				}
+				level = append(level, field{name: sf.Name, index: index})
+				count[sf.Name]++
+			}
+		}
+		for _, f := range level {
+			if !taken[f.name] && count[f.name] == 1 {
+				list = append(list, f)
+			}
+		}
+		for name := range count {
+			taken[name] = true
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		a, b := list[i].index, list[j].index
+		for k := 0; k < len(a) && k < len(b); k++ {
+			if a[k] != b[k] {
+				return a[k] < b[k]
+			}
+		}
+		return len(a) < len(b)
+	})
+	fields := &structFields{list: list, byName: make(map[string]*field, len(list))}
+	for i := range fields.list {
+		fields.byName[fields.list[i].name] = &fields.list[i]
+	}
+	return fields
+}
+
+func fieldByIndex(v reflect.Value, index []int, alloc bool) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				if !alloc || !v.CanSet() {
+					return reflect.Value{}, false
+				}
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
@@ -0,0 +1,131 @@
+package rpc_yqaty
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	ProtocolVersion    = 1
+	MinProtocolVersion = 1
+)
+
+var builtinFeatures = []string{"stream", "heartbeat", "idempotency"}
+
+type Hello struct {
+	Version     int
+	MinVersion  int
+	Codecs      string
+	Compression string
+	Features    string
+	Heartbeat   time.Duration
+}
+
+func splitList(list string) []string {
+	if list == "" {
+		return nil
+	}
+	return strings.Split(list, ",")
+}
+
+func (hello Hello) HasFeature(feature string) bool {
+	for _, f := range splitList(hello.Features) {
+		if f == feature {
+			return true
+		}
+	}
+	return false
+}
+
+func localHello(compression []string, features []string) Hello {
+	return Hello{
+		Version:     ProtocolVersion,
+		MinVersion:  MinProtocolVersion,
+		Codecs:      "json",
+		Compression: strings.Join(compression, ","),
+		Features:    strings.Join(append(append([]string{}, builtinFeatures...), features...), ","),
+	}
+}
+
+func common(preferred string, supported string) []string {
+	var list []string
+	for _, a := range splitList(preferred) {
+		for _, b := range splitList(supported) {
+			if a == b {
+				list = append(list, a)
+				break
+			}
+		}
+	}
+	return list
+}
+
+func negotiate(local Hello, remote Hello) (Hello, error) {
+	version := local.Version
+	if remote.Version < version {
+		version = remote.Version
+	}
+	if version < local.MinVersion || version < remote.MinVersion {
+		return Hello{}, &Error{Code: CodeUnimplemented, Message: fmt.Sprintf("protocol version mismatch: local %d-%d, remote %d-%d", local.MinVersion, local.Version, remote.MinVersion, remote.Version)}
+	}
+	codecs := common(remote.Codecs, local.Codecs)
+	if len(codecs) == 0 {
+		return Hello{}, &Error{Code: CodeUnimplemented, Message: fmt.Sprintf("no common codec: local %q, remote %q", local.Codecs, remote.Codecs)}
+	}
+	hello := Hello{Version: version, MinVersion: version, Codecs: codecs[0], Features: strings.Join(common(remote.Features, local.Features), ","), Heartbeat: remote.Heartbeat}
+	if compression := common(remote.Compression, local.Compression); len(compression) > 0 {
+		hello.Compression = compression[0]
+	}
+	return hello, nil
+}
+
+func (server *Server) handshake(conn *serverConn, req *Request) error {
+	var remote Hello
+	if err := conn.codec.ReadRequestBody(&remote); err != nil {
+		return err
+	}
+	hello, err := negotiate(localHello(compressorNames(), server.Features), remote)
+	if err != nil {
+		conn.send(&Response{Seq: req.Seq, Frame: FrameHello, Error: err.Error(), Code: ErrorCode(err)}, &Data{nil})
+		return err
+	}
+	conn.protocol = hello
+	conn.sending.Lock()
+	conn.codec.writer.compressor, conn.codec.writer.threshold = lookupCompressor(hello.Compression), server.CompressThreshold
+	conn.sending.Unlock()
+	return conn.send(&Response{Seq: req.Seq, Frame: FrameHello}, &Data{hello})
+}
+
+func (client *Client) start() error {
+	go client.Listen()
+	hello := localHello(client.Compression, client.Features)
+	hello.Heartbeat = client.HeartbeatInterval
+	query := &Query{Args: hello, Reply: &Hello{}, frame: FrameHello, Done: make(chan *Query, 1)}
+	timer := time.NewTimer(callTimeout)
+	defer timer.Stop()
+	client.Deal(query)
+	select {
+	case <-query.Done:
+	case <-timer.C:
+		client.abandon(query)
+		query.Error = errTimeout
+	}
+	if query.Error != nil {
+		client.Close()
+		return query.Error
+	}
+	client.mutex.Lock()
+	client.protocol = *query.Reply.(*Hello)
+	if codec, ok := client.codec.(*ClientCodec); ok {
+		codec.writer.compressor, codec.writer.threshold = lookupCompressor(client.protocol.Compression), client.CompressThreshold
+	}
+	client.mutex.Unlock()
+	return nil
+}
+
+func (client *Client) Protocol() Hello {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+	return client.protocol
+}
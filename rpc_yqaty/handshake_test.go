@@ -0,0 +1,46 @@
+package rpc_yqaty
+
+import (
+	"net"
+	"testing"
+)
+
+func TestHandshake(t *testing.T) {
+	server := GetServer()
+	server.Register("add", (*Func).Add)
+	server.Features = []string{"tracing"}
+	addr := serve(t, server)
+	client := GetClient()
+	client.Features = []string{"tracing", "batch"}
+	if err := client.Dial(addr); err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	hello := client.Protocol()
+	if hello.Version != ProtocolVersion || hello.Codecs != "json" || !hello.HasFeature("tracing") || hello.HasFeature("batch") {
+		t.Errorf("unexpected protocol %+v", hello)
+	}
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacy := GetClient()
+	legacy.InitCodec(conn)
+	go legacy.Listen()
+	defer legacy.Close()
+	var reply int
+	if err := legacy.Call("add", Struct1{1, 2}, &reply); err != nil || reply != 3 {
+		t.Errorf("expect a client without handshake to be served, output %v %v", reply, err)
+	}
+
+	local := localHello(nil, nil)
+	for _, remote := range []Hello{{Version: 2, MinVersion: 2, Codecs: "json"}, {Version: 1, MinVersion: 1, Codecs: "msgpack"}} {
+		if _, err := negotiate(local, remote); ErrorCode(err) != CodeUnimplemented {
+			t.Errorf("%+v: expect code %v, output %v", remote, CodeUnimplemented, err)
+		}
+	}
+	if hello, err := negotiate(local, Hello{Version: 3, MinVersion: 1, Codecs: "msgpack,json"}); err != nil || hello.Version != 1 || hello.Codecs != "json" {
+		t.Errorf("expect version 1 with json, output %+v %v", hello, err)
+	}
+}
@@ -0,0 +1,50 @@
+package rpc_yqaty
+
+import "time"
+
+const DefaultMaxMissedHeartbeats = 3
+
+var errHeartbeat = &Error{Code: CodeUnavailable, Message: "the connection is dead: missed heartbeats"}
+
+func (client *Client) heartbeat(stop chan struct{}) {
+	missed := client.MaxMissedHeartbeats
+	if missed <= 0 {
+		missed = DefaultMaxMissedHeartbeats
+	}
+	ticker := time.NewTicker(client.HeartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		if time.Since(time.Unix(0, client.lastSeen.Load())) > time.Duration(missed)*client.HeartbeatInterval {
+			client.dead.Store(true)
+			client.codec.Close()
+			return
+		}
+		go client.SendRequest(&Request{Frame: FramePing}, nil)
+	}
+}
+
+func (conn *serverConn) keepalive() func() {
+	interval := conn.protocol.Heartbeat
+	if interval <= 0 {
+		return func() {}
+	}
+	stop := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				conn.send(&Response{Frame: FramePong}, &Data{nil})
+			}
+		}
+	}()
+	return func() { close(stop) }
+}
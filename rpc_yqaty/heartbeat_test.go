@@ -0,0 +1,140 @@
+package rpc_yqaty
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func silentProxy(t *testing.T, addr string) (string, *atomic.Bool) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { lis.Close() })
+	silent := new(atomic.Bool)
+	pipe := func(dst net.Conn, src net.Conn) {
+		defer dst.Close()
+		buf := make([]byte, 4096)
+		for {
+			n, err := src.Read(buf)
+			if err != nil {
+				return
+			}
+			if !silent.Load() {
+				dst.Write(buf[:n])
+			}
+		}
+	}
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			backend, err := net.Dial("tcp", addr)
+			if err != nil {
+				conn.Close()
+				continue
+			}
+			go pipe(backend, conn)
+			go pipe(conn, backend)
+		}
+	}()
+	return lis.Addr().String(), silent
+}
+
+func TestHeartbeat(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+	go func() {
+		conn, err := lis.Accept()
+		if err == nil {
+			defer conn.Close()
+			time.Sleep(time.Second)
+		}
+	}()
+	client := GetClient()
+	client.HeartbeatInterval = 20 * time.Millisecond
+	client.MaxMissedHeartbeats = 2
+	begin := time.Now()
+	if err := client.Dial(lis.Addr().String()); err != errHeartbeat {
+		t.Errorf("expect %v, output %v", errHeartbeat, err)
+	}
+	if cost := time.Since(begin); cost > 500*time.Millisecond {
+		t.Errorf("expect the dead connection to be detected quickly, took %v", cost)
+	}
+
+	backend := GetServer()
+	backend.Register("sleep", (*Func).Sleep)
+	addr, silent := silentProxy(t, serve(t, backend))
+	client = GetClient()
+	client.HeartbeatInterval = 20 * time.Millisecond
+	client.MaxMissedHeartbeats = 2
+	if err := client.Dial(addr); err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	silent.Store(true)
+	begin = time.Now()
+	if err := client.Call("sleep", Struct1{2000, 1}, new(int)); ErrorCode(err) != CodeUnavailable {
+		t.Errorf("expect the in-flight call to fail with %v, output %v", CodeUnavailable, err)
+	}
+	if cost := time.Since(begin); cost > 500*time.Millisecond {
+		t.Errorf("expect the dead connection to be detected quickly, took %v", cost)
+	}
+
+	server := GetServer()
+	server.Register("add", (*Func).Add)
+	server.IdleTimeout = 50 * time.Millisecond
+	addr = serve(t, server)
+	alive, idle := GetClient(), GetClient()
+	alive.HeartbeatInterval = 10 * time.Millisecond
+	for _, client := range []*Client{alive, idle} {
+		if err := client.Dial(addr); err != nil {
+			t.Fatal(err)
+		}
+		defer client.Close()
+	}
+	time.Sleep(150 * time.Millisecond)
+	if err := alive.Call("add", Struct1{1, 2}, new(int)); err != nil {
+		t.Errorf("expect heartbeats to keep the connection open, output %v", err)
+	}
+	if err := idle.Call("add", Struct1{1, 2}, new(int)); ErrorCode(err) != CodeUnavailable {
+		t.Errorf("expect the idle connection to be closed, output %v", err)
+	}
+}
+
+func TestHeartbeatBusyServer(t *testing.T) {
+	server := GetServer()
+	server.Register("sleep", (*Func).Sleep)
+	server.Register("ordered", (*Func).Sleep, Ordered())
+	server.MaxConnRequests = 1
+	client := GetClient()
+	client.HeartbeatInterval = 50 * time.Millisecond
+	client.MaxMissedHeartbeats = 3
+	if err := client.Dial(serve(t, server)); err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	for _, name := range []string{"ordered", "sleep"} {
+		errs := make([]error, 2)
+		wg := new(sync.WaitGroup)
+		for i := range errs {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				errs[i] = client.Call(name, Struct1{500, i}, new(int))
+			}(i)
+		}
+		wg.Wait()
+		if errs[0] != nil || errs[1] != nil {
+			t.Errorf("%s: expect a busy connection to stay alive, output %v %v", name, errs[0], errs[1])
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package rpc_yqaty
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+const (
+	DefaultRPCPath  = "/_rpc_yqaty_"
+	HTTPCallPrefix  = "/rpc/"
+	connected       = "200 Connected to rpc_yqaty"
+	PrincipalHeader = "X-Rpc-Principal"
+)
+
+func (server *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodConnect:
+		server.serveConnect(w, r)
+	case http.MethodGet:
+		server.ServeWebSocket(w, r)
+	case http.MethodPost:
+		if r.URL.Path == JSONRPCPath {
+			server.serveJSONRPCHTTP(w, r)
+			return
+		}
+		server.servePost(w, r)
+	default:
+		w.Header().Set("Allow", "GET, POST, CONNECT")
+		http.Error(w, "rpc: GET, POST or CONNECT required", http.StatusMethodNotAllowed)
+	}
+}
+
+func (server *Server) serveConnect(w http.ResponseWriter, r *http.Request) {
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "rpc: connection can not be hijacked", http.StatusInternalServerError)
+		return
+	}
+	conn, _, err := hijacker.Hijack()
+	if err != nil {
+		log.Println("rpc hijacking", r.RemoteAddr, ":", err)
+		return
+	}
+	io.WriteString(conn, "HTTP/1.0 "+connected+"\n\n")
+	server.InitCodec(conn)
+}
+
+func (server *Server) servePost(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.URL.Path, HTTPCallPrefix) {
+		http.NotFound(w, r)
+		return
+	}
+	name := strings.TrimPrefix(r.URL.Path, HTTPCallPrefix)
+	method, ok := server.Mp[name]
+	if !ok {
+		http.Error(w, errNotRegistered.Error(), http.StatusNotFound)
+		return
+	}
+	if err := server.allow(peerHost(r.RemoteAddr), r.Header.Get(PrincipalHeader), name); err != nil {
+		var e *Error
+		if errors.As(err, &e) && e.RetryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.FormatInt(int64(math.Ceil(e.RetryAfter.Seconds())), 10))
+		}
+		http.Error(w, err.Error(), httpStatus(err))
+		return
+	}
+	decoder := newDecoder(r.Body, server.Limits)
+	args := reflect.New(method.ArgsType)
+	if err := decoder.JSONDecode(args.Interface()); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !server.acquire(nil, server.LimitPolicy == LimitBlock) {
+		http.Error(w, errResourceExhausted.Error(), http.StatusTooManyRequests)
+		return
+	}
+	reply, err := server.invokeTimeout(name, r.Header.Get("Idempotency-Key"), method, args.Elem())
+	server.release(nil)
+	if err != nil {
+		http.Error(w, err.Error(), httpStatus(err))
+		return
+	}
+	buf := getBuffer()
+	defer putBuffer(buf)
+	encoder := &Encoder{buf}
+	if err := encoder.JSONEncode(reply.Interface()); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(buf.Bytes())
+}
+
+func (server *Server) HandleHTTP(rpcPath string) {
+	http.Handle(rpcPath, server)
+	http.Handle(HTTPCallPrefix, server)
+	http.Handle(JSONRPCPath, server)
+	http.Handle(WebSocketPath, server)
+}
+
+func (client *Client) DialHTTP(addr string) error {
+	return client.DialHTTPPath(addr, DefaultRPCPath)
+}
+
+func (client *Client) DialHTTPPath(addr string, path string) error {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return err
+	}
+	io.WriteString(conn, "CONNECT "+path+" HTTP/1.0\n\n")
+	resp, err := http.ReadResponse(bufio.NewReader(conn), &http.Request{Method: http.MethodConnect})
+	if err == nil && resp.Status == connected {
+		client.InitCodec(conn)
+		return client.start()
+	}
+	if err == nil {
+		err = errors.New("unexpected HTTP response: " + resp.Status)
+	}
+	conn.Close()
+	return err
+}
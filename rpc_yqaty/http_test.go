@@ -0,0 +1,51 @@
+package rpc_yqaty
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHTTP(t *testing.T) {
+	server := GetServer()
+	server.Register("add", (*Func).Add)
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	{
+		resp, err := http.Post(ts.URL+"/rpc/add", "application/json", strings.NewReader("{\"A\":1,\"B\":2}"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || string(body) != "3" {
+			t.Errorf("POST add: status %d, body %s", resp.StatusCode, body)
+		}
+	}
+
+	{
+		resp, err := http.Post(ts.URL+"/rpc/sub", "application/json", strings.NewReader("{\"A\":1,\"B\":2}"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNotFound {
+			t.Errorf("POST sub: expect status 404, output %d", resp.StatusCode)
+		}
+	}
+
+	{
+		client := GetClient()
+		if err := client.DialHTTP(ts.Listener.Addr().String()); err != nil {
+			t.Fatal(err)
+		}
+		reply := new(int)
+		if err := client.Call("add", Struct1{3, 4}, reply); err != nil || *reply != 7 {
+			t.Errorf("CONNECT add: reply %v, err %v", *reply, err)
+		}
+		client.Close()
+	}
+}
@@ -0,0 +1,354 @@
+package rpc_yqaty
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+const (
+	JSONRPCParseError     = -32700
+	JSONRPCInvalidRequest = -32600
+	JSONRPCMethodNotFound = -32601
+	JSONRPCInvalidParams  = -32602
+	JSONRPCInternalError  = -32603
+	JSONRPCServerError    = -32000
+)
+
+const JSONRPCPath = "/jsonrpc"
+
+type RawMessage string
+
+func (m RawMessage) MarshalRPC() ([]byte, error) {
+	if m == "" {
+		return []byte("null"), nil
+	}
+	return []byte(m), nil
+}
+
+func (m *RawMessage) UnmarshalRPC(data []byte) error {
+	*m = RawMessage(data)
+	return nil
+}
+
+type JSONRPCError struct {
+	Code    int
+	Message string
+}
+
+func (e *JSONRPCError) Error() string {
+	return e.Message
+}
+
+func splitRawArray(raw RawMessage, limits DecodeLimits) ([]RawMessage, error) {
+	codec := newDecoder(strings.NewReader(string(raw)), limits)
+	if err := codec.consume("["); err != nil {
+		return nil, err
+	}
+	items := []RawMessage{}
+	for {
+		str, err := codec.Read()
+		if err != nil {
+			return nil, err
+		}
+		if str == "]" {
+			return items, nil
+		}
+		if codec.limits.MaxCollection > 0 && len(items) >= codec.limits.MaxCollection {
+			return nil, codec.fail(errCollectionTooLong)
+		}
+		if len(items) > 0 {
+			if str != "," {
+				return nil, errors.New("decode failed")
+			}
+		} else {
+			codec.unread(str)
+		}
+		item, err := codec.readRaw()
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, RawMessage(item))
+	}
+}
+
+func jsonrpcResponse(id RawMessage, result any, rerr *JSONRPCError) RawMessage {
+	buf := new(bytes.Buffer)
+	encoder := &Encoder{buf}
+	encoder.s.WriteString("{\"jsonrpc\":\"2.0\",\"id\":")
+	encoder.JSONEncode(id)
+	if rerr == nil {
+		encoder.s.WriteString(",\"result\":")
+		if err := encoder.JSONEncode(result); err != nil {
+			return jsonrpcResponse(id, nil, &JSONRPCError{JSONRPCInternalError, err.Error()})
+		}
+	} else {
+		fmt.Fprintf(encoder.s, ",\"error\":{\"code\":%d,\"message\":", rerr.Code)
+		encoder.writeString(rerr.Message)
+		encoder.s.WriteString("}")
+	}
+	encoder.s.WriteString("}")
+	return RawMessage(buf.String())
+}
+
+type JSONRPCServerCodec struct {
+	conn    io.ReadWriteCloser
+	decoder *Decoder
+}
+
+func (scodec *JSONRPCServerCodec) ReadMessage() (RawMessage, error) {
+	scodec.decoder.begin()
+	raw, err := scodec.decoder.readRaw()
+	return RawMessage(raw), err
+}
+
+func (scodec *JSONRPCServerCodec) WriteMessage(msg RawMessage) error {
+	_, err := io.WriteString(scodec.conn, string(msg)+"\n")
+	return err
+}
+
+func (scodec *JSONRPCServerCodec) Close() {
+	scodec.conn.Close()
+}
+
+func (server *Server) callJSONRPC(msg RawMessage, peer string, principal string) RawMessage {
+	if !strings.HasPrefix(string(msg), "{") {
+		return jsonrpcResponse("", nil, &JSONRPCError{JSONRPCInvalidRequest, "invalid request"})
+	}
+	envelope := server.Limits
+	if envelope.MaxCollection > 0 && envelope.MaxCollection < 4 {
+		envelope.MaxCollection = 4
+	}
+	fields := make(map[string]RawMessage)
+	if err := unmarshalLimits(string(msg), &fields, envelope); err != nil {
+		return jsonrpcResponse("", nil, &JSONRPCError{JSONRPCParseError, err.Error()})
+	}
+	id, hasID := fields["id"]
+	var version, name string
+	if UnMarshal(string(fields["jsonrpc"]), &version) != nil || version != "2.0" || UnMarshal(string(fields["method"]), &name) != nil || name == "" {
+		return jsonrpcResponse(id, nil, &JSONRPCError{JSONRPCInvalidRequest, "invalid request"})
+	}
+	fail := func(code int, message string) RawMessage {
+		if !hasID {
+			return ""
+		}
+		return jsonrpcResponse(id, nil, &JSONRPCError{code, message})
+	}
+	method, ok := server.Mp[name]
+	if !ok {
+		return fail(JSONRPCMethodNotFound, errNotRegistered.Error())
+	}
+	args := reflect.New(method.ArgsType)
+	if params, ok := fields["params"]; ok && params != "null" {
+		if strings.HasPrefix(string(params), "[") {
+			items, err := splitRawArray(params, server.Limits)
+			if err != nil || len(items) != 1 {
+				return fail(JSONRPCInvalidParams, "params must hold exactly one argument")
+			}
+			params = items[0]
+		}
+		if err := unmarshalLimits(string(params), args.Interface(), server.Limits); err != nil {
+			return fail(JSONRPCInvalidParams, err.Error())
+		}
+	}
+	if err := server.allow(peer, principal, name); err != nil {
+		return fail(JSONRPCServerError, err.Error())
+	}
+	if !server.acquire(nil, server.LimitPolicy == LimitBlock) {
+		return fail(JSONRPCServerError, errResourceExhausted.Error())
+	}
+	reply, err := server.invokeTimeout(name, "", method, args.Elem())
+	server.release(nil)
+	if err != nil {
+		return fail(JSONRPCServerError, err.Error())
+	}
+	if !hasID {
+		return ""
+	}
+	return jsonrpcResponse(id, reply.Interface(), nil)
+}
+
+func (server *Server) handleJSONRPC(msg RawMessage, peer string, principal string) RawMessage {
+	if !strings.HasPrefix(string(msg), "[") {
+		return server.callJSONRPC(msg, peer, principal)
+	}
+	items, err := splitRawArray(msg, server.Limits)
+	if err != nil {
+		return jsonrpcResponse("", nil, &JSONRPCError{JSONRPCParseError, err.Error()})
+	}
+	if len(items) == 0 {
+		return jsonrpcResponse("", nil, &JSONRPCError{JSONRPCInvalidRequest, "empty batch"})
+	}
+	resps := make([]RawMessage, len(items))
+	wg := new(sync.WaitGroup)
+	for i := range items {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			resps[i] = server.callJSONRPC(items[i], peer, principal)
+		}(i)
+	}
+	wg.Wait()
+	var batch strings.Builder
+	for _, resp := range resps {
+		if resp == "" {
+			continue
+		}
+		if batch.Len() == 0 {
+			batch.WriteString("[")
+		} else {
+			batch.WriteString(",")
+		}
+		batch.WriteString(string(resp))
+	}
+	if batch.Len() == 0 {
+		return ""
+	}
+	batch.WriteString("]")
+	return RawMessage(batch.String())
+}
+
+func (server *Server) ServeJSONRPC(conn io.ReadWriteCloser) {
+	codec := &JSONRPCServerCodec{conn: conn, decoder: newDecoder(conn, server.Limits)}
+	peer := connPeer(conn)
+	inflight := newSemaphore(server.MaxConnRequests)
+	sending := new(sync.Mutex)
+	wg := new(sync.WaitGroup)
+	for {
+		msg, err := codec.ReadMessage()
+		if err != nil {
+			break
+		}
+		inflight.acquire(true)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer inflight.release()
+			if resp := server.handleJSONRPC(msg, peer, ""); resp != "" {
+				sending.Lock()
+				codec.WriteMessage(resp)
+				sending.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	codec.Close()
+}
+
+func (server *Server) AcceptJSONRPC(addr string) error {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	for {
+		conn, err := lis.Accept()
+		if err != nil {
+			return err
+		}
+		go server.ServeJSONRPC(conn)
+	}
+}
+
+func (server *Server) serveJSONRPCHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, server.Limits.withDefaults().MaxMessageBytes))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, errMessageTooLarge.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	resp := server.handleJSONRPC(RawMessage(bytes.TrimSpace(body)), peerHost(r.RemoteAddr), r.Header.Get(PrincipalHeader))
+	if resp == "" {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	io.WriteString(w, string(resp))
+}
+
+type JSONRPCClientCodec struct {
+	conn    io.ReadWriteCloser
+	encoder *Encoder
+	decoder *Decoder
+	result  RawMessage
+}
+
+func (codec *JSONRPCClientCodec) WriteRequest(req *Request, data any) error {
+	buf := getBuffer()
+	defer putBuffer(buf)
+	codec.encoder.s = buf
+	codec.encoder.s.WriteString("{\"jsonrpc\":\"2.0\",")
+	if req.Seq != 0 {
+		fmt.Fprintf(codec.encoder.s, "\"id\":%d,", req.Seq)
+	}
+	codec.encoder.s.WriteString("\"method\":")
+	codec.encoder.writeString(req.MethodName)
+	codec.encoder.s.WriteString(",\"params\":[")
+	if err := codec.encoder.JSONEncode(data); err != nil {
+		return err
+	}
+	codec.encoder.s.WriteString("]}\n")
+	_, err := codec.conn.Write(buf.Bytes())
+	return err
+}
+
+func (codec *JSONRPCClientCodec) ReadResponseHeader(resp *Response) error {
+	codec.decoder.begin()
+	fields := make(map[string]RawMessage)
+	if err := codec.decoder.JSONDecode(&fields); err != nil {
+		return err
+	}
+	if id := fields["id"]; id != "" && id != "null" {
+		if err := UnMarshal(string(id), &resp.Seq); err != nil {
+			return err
+		}
+	}
+	codec.result = fields["result"]
+	if rerr, ok := fields["error"]; ok && rerr != "null" {
+		efields := make(map[string]RawMessage)
+		if err := UnMarshal(string(rerr), &efields); err != nil {
+			return err
+		}
+		UnMarshal(string(efields["message"]), &resp.Error)
+		if resp.Error == "" {
+			resp.Error = "jsonrpc error " + string(efields["code"])
+		}
+	}
+	return nil
+}
+
+func (codec *JSONRPCClientCodec) ReadResponseBody(data *Data) error {
+	if data == nil || codec.result == "" {
+		return nil
+	}
+	return UnMarshal(string(codec.result), data.Reply)
+}
+
+func (codec *JSONRPCClientCodec) Close() error {
+	return codec.conn.Close()
+}
+
+func (client *Client) InitJSONRPCCodec(conn io.ReadWriteCloser) error {
+	codec := &JSONRPCClientCodec{conn: conn, decoder: newDecoder(conn, client.Limits), encoder: &Encoder{&bytes.Buffer{}}}
+	client.codec = codec
+	return nil
+}
+
+func (client *Client) DialJSONRPC(addr string) error {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return err
+	}
+	client.InitJSONRPCCodec(conn)
+	go client.Listen()
+	return nil
+}
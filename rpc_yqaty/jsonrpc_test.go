@@ -0,0 +1,200 @@
+package rpc_yqaty
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func (f *Func) Fail(A Struct1, B *int) error {
+	return errors.New("fail")
+}
+
+func (f *Func) Quote(A string, B *string) error {
+	*B = "<" + A + ">"
+	return nil
+}
+
+func jsonrpcServer(t *testing.T) string {
+	t.Helper()
+	server := GetServer()
+	server.Register("add", (*Func).Add)
+	server.Register("fail", (*Func).Fail)
+	server.Register("quote", (*Func).Quote)
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { lis.Close() })
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			go server.ServeJSONRPC(conn)
+		}
+	}()
+	return lis.Addr().String()
+}
+
+func TestJSONRPCWire(t *testing.T) {
+	conn, err := net.Dial("tcp", jsonrpcServer(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+
+	tests := []struct {
+		req  string
+		resp string
+	}{
+		{
+			"{\"jsonrpc\":\"2.0\",\"id\":1,\"method\":\"add\",\"params\":[{\"A\":1,\"B\":2}]}",
+			"{\"jsonrpc\":\"2.0\",\"id\":1,\"result\":3}",
+		},
+		{
+			"{\"jsonrpc\":\"2.0\",\"id\":\"a\",\"method\":\"add\",\"params\":{\"A\":-1,\"B\":-2}}",
+			"{\"jsonrpc\":\"2.0\",\"id\":\"a\",\"result\":-3}",
+		},
+		{
+			"{\"jsonrpc\":\"2.0\",\"id\":2,\"method\":\"fail\",\"params\":[{\"A\":1,\"B\":2}]}",
+			"{\"jsonrpc\":\"2.0\",\"id\":2,\"error\":{\"code\":-32000,\"message\":\"fail\"}}",
+		},
+		{
+			"[{\"jsonrpc\":\"2.0\",\"id\":3,\"method\":\"sub\"},{\"jsonrpc\":\"2.0\",\"method\":\"add\",\"params\":[{\"A\":1,\"B\":2}]},{\"id\":4}]",
+			"[{\"jsonrpc\":\"2.0\",\"id\":3,\"error\":{\"code\":-32601,\"message\":\"the name has not been register\"}},{\"jsonrpc\":\"2.0\",\"id\":4,\"error\":{\"code\":-32600,\"message\":\"invalid request\"}}]",
+		},
+		{
+			"{\"jsonrpc\":\"2.0\",\"id\":5,\"method\":\"quote\",\"params\":[\"a\\/b \\ud83d\\ude00\"]}",
+			"{\"jsonrpc\":\"2.0\",\"id\":5,\"result\":\"<a/b \U0001F600>\"}",
+		},
+		{
+			"[{\"jsonrpc\":\"2.0\",\"method\":\"add\",\"params\":[1,2]},{\"jsonrpc\":\"2.0\",\"method\":\"fail\",\"params\":[{}]},{\"jsonrpc\":\"2.0\",\"id\":6,\"method\":\"add\",\"params\":[1,2]}]",
+			"[{\"jsonrpc\":\"2.0\",\"id\":6,\"error\":{\"code\":-32602,\"message\":\"params must hold exactly one argument\"}}]",
+		},
+		{
+			"{\"jsonrpc\":\"2.0\",\"method\":\"add\",\"params\":[1,2]}\n{\"jsonrpc\":\"2.0\",\"method\":\"sub\"}\n{\"jsonrpc\":\"2.0\",\"id\":7,\"method\":\"add\",\"params\":{\"A\":2}}",
+			"{\"jsonrpc\":\"2.0\",\"id\":7,\"result\":2}",
+		},
+		{
+			"[]",
+			"{\"jsonrpc\":\"2.0\",\"id\":null,\"error\":{\"code\":-32600,\"message\":\"empty batch\"}}",
+		},
+	}
+	for _, test := range tests {
+		io.WriteString(conn, test.req+"\n")
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		if line[:len(line)-1] != test.resp {
+			t.Errorf("request %s: expect %s, output %s", test.req, test.resp, line)
+		}
+	}
+}
+
+func TestJSONRPCClient(t *testing.T) {
+	client := GetClient()
+	if err := client.DialJSONRPC(jsonrpcServer(t)); err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	reply := new(int)
+	if err := client.Call("add", Struct1{1, 2}, reply); err != nil || *reply != 3 {
+		t.Errorf("add: reply %v, err %v", *reply, err)
+	}
+	if err := client.Call("fail", Struct1{1, 2}, reply); err == nil || err.Error() != "fail" {
+		t.Errorf("fail: expect error fail, output %v", err)
+	}
+	if err := client.Notify("add", Struct1{1, 2}); err != nil {
+		t.Error(err)
+	}
+	if err := client.Call("add", Struct1{2, 2}, reply); err != nil || *reply != 4 {
+		t.Errorf("add: reply %v, err %v", *reply, err)
+	}
+}
+
+func TestJSONStrings(t *testing.T) {
+	for _, test := range []struct {
+		in  string
+		out string
+	}{
+		{`"plain"`, "plain"},
+		{`"a\/b"`, "a/b"},
+		{`"\ud83d\ude00"`, "\U0001F600"},
+		{`"\u00e9\"\\\b\f\n\r\t"`, "\u00e9\"\\\b\f\n\r\t"},
+		{`"\ud83d!"`, "\uFFFD!"},
+		{`"\ud83d\u0041"`, "\uFFFDA"},
+	} {
+		var s string
+		if err := UnMarshal(test.in, &s); err != nil || s != test.out {
+			t.Errorf("%s: expect %q, output %q %v", test.in, test.out, s, err)
+		}
+	}
+	for _, in := range []string{`"\x41"`, `"\u12"`, `"\a"`} {
+		var s string
+		if err := UnMarshal(in, &s); err == nil {
+			t.Errorf("%s: expect an error, output %q", in, s)
+		}
+	}
+
+	var m map[string]any
+	if err := UnMarshal(`{"k\/1":"\ud83d\ude00"}`, &m); err != nil || m["k/1"] != "\U0001F600" {
+		t.Errorf("expect an unescaped key and value, output %v %v", m, err)
+	}
+}
+
+func TestJSONRPCLimits(t *testing.T) {
+	server := GetServer()
+	server.Register("total", (*Func).Total)
+	server.Limits = DecodeLimits{MaxMessageBytes: 512, MaxCollection: 3}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	item := "{\"A\":1,\"B\":1}"
+	tests := []struct {
+		body   string
+		status int
+		resp   string
+	}{
+		{
+			"{\"jsonrpc\":\"2.0\",\"id\":1,\"method\":\"total\",\"params\":[[" + strings.Repeat(item+",", 2) + item + "]]}",
+			http.StatusOK,
+			"{\"jsonrpc\":\"2.0\",\"id\":1,\"result\":3}",
+		},
+		{
+			"{\"jsonrpc\":\"2.0\",\"id\":2,\"method\":\"total\",\"params\":[[" + strings.Repeat(item+",", 7) + item + "]]}",
+			http.StatusOK,
+			"{\"jsonrpc\":\"2.0\",\"id\":2,\"error\":{\"code\":-32602,\"message\":\"decode: collection too long\"}}",
+		},
+		{
+			"[" + strings.Repeat("{\"jsonrpc\":\"2.0\",\"id\":3,\"method\":\"total\",\"params\":[[]]},", 3) + "{}]",
+			http.StatusOK,
+			"{\"jsonrpc\":\"2.0\",\"id\":null,\"error\":{\"code\":-32700,\"message\":\"decode: collection too long\"}}",
+		},
+		{
+			"{\"jsonrpc\":\"2.0\",\"id\":4,\"method\":\"total\",\"params\":[[" + strings.Repeat(item+",", 40) + item + "]]}",
+			http.StatusRequestEntityTooLarge,
+			"decode: message too large\n",
+		},
+	}
+	for _, test := range tests {
+		resp, err := http.Post(ts.URL+JSONRPCPath, "application/json", strings.NewReader(test.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != test.status || string(body) != test.resp {
+			t.Errorf("%.40s: expect %d %s, output %d %s", test.body, test.status, test.resp, resp.StatusCode, body)
+		}
+	}
+}
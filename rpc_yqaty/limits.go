@@ -0,0 +1,81 @@
+package rpc_yqaty
+
+type LimitPolicy int
+
+const (
+	LimitBlock LimitPolicy = iota
+	LimitReject
+)
+
+var errResourceExhausted = &Error{Code: CodeResourceExhausted, Message: "too many requests in flight"}
+
+type semaphore chan struct{}
+
+func newSemaphore(n int) semaphore {
+	if n <= 0 {
+		return nil
+	}
+	return make(semaphore, n)
+}
+
+func (sem semaphore) acquire(block bool) bool {
+	if sem == nil {
+		return true
+	}
+	if block {
+		sem <- struct{}{}
+		return true
+	}
+	select {
+	case sem <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+func (sem semaphore) release() {
+	if sem != nil {
+		<-sem
+	}
+}
+
+func (server *Server) slots(stream bool) semaphore {
+	server.once.Do(func() {
+		server.inflight = newSemaphore(server.MaxServerRequests)
+		server.streaming = newSemaphore(server.MaxServerStreams)
+	})
+	if stream {
+		return server.streaming
+	}
+	return server.inflight
+}
+
+func (server *Server) acquire(conn semaphore, block bool) bool {
+	return server.acquireFrom(conn, server.slots(false), block)
+}
+
+func (server *Server) acquireStream(conn semaphore) bool {
+	return server.acquireFrom(conn, server.slots(true), false)
+}
+
+func (server *Server) acquireFrom(conn semaphore, shared semaphore, block bool) bool {
+	if !conn.acquire(block) {
+		return false
+	}
+	if !shared.acquire(block) {
+		conn.release()
+		return false
+	}
+	return true
+}
+
+func (server *Server) release(conn semaphore) {
+	server.slots(false).release()
+	conn.release()
+}
+
+func (server *Server) releaseStream(conn semaphore) {
+	server.slots(true).release()
+	conn.release()
+}
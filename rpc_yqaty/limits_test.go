@@ -0,0 +1,111 @@
+package rpc_yqaty
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func (f *Func) Sleep(A Struct1, B *int) error {
+	time.Sleep(time.Duration(A.A) * time.Millisecond)
+	*B = A.B
+	return nil
+}
+
+func TestLimits(t *testing.T) {
+	server := GetServer()
+	server.Register("sleep", (*Func).Sleep)
+	server.MaxConnRequests = 1
+	server.LimitPolicy = LimitReject
+	client := GetClient()
+	if err := client.Dial(serve(t, server)); err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	errs := make([]error, 2)
+	wg := new(sync.WaitGroup)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = client.Call("sleep", Struct1{200, i}, new(int))
+		}(i)
+	}
+	wg.Wait()
+	if (errs[0] == nil) == (errs[1] == nil) {
+		t.Fatalf("expect exactly one call to be rejected, output %v %v", errs[0], errs[1])
+	}
+	for _, err := range errs {
+		if err != nil && ErrorCode(err) != CodeResourceExhausted {
+			t.Errorf("expect code %v, output %v", CodeResourceExhausted, ErrorCode(err))
+		}
+	}
+
+	if err := client.Call("nope", Struct1{}, new(int)); ErrorCode(err) != CodeNotFound {
+		t.Errorf("nope: expect code %v, output %v", CodeNotFound, ErrorCode(err))
+	}
+
+	server.LimitPolicy = LimitBlock
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = client.Call("sleep", Struct1{50, i}, new(int))
+		}(i)
+	}
+	wg.Wait()
+	if errs[0] != nil || errs[1] != nil {
+		t.Errorf("expect both calls to be queued, output %v %v", errs[0], errs[1])
+	}
+}
+
+func TestLimitsWithStreams(t *testing.T) {
+	server := GetServer()
+	server.Register("sum", (*Func).Sum)
+	server.Register("add", (*Func).Add)
+	server.MaxConnRequests = 1
+	server.MaxConnStreams = 1
+	client := GetClient()
+	if err := client.Dial(serve(t, server)); err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	stream, err := OpenSendStream[int, int](client, "sum")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := stream.Send(1); err != nil {
+		t.Fatal(err)
+	}
+	var reply int
+	if err := client.Call("add", Struct1{1, 2}, &reply); err != nil || reply != 3 {
+		t.Fatalf("add: expect 3 while a stream is open, output %v %v", reply, err)
+	}
+	second, err := OpenSendStream[int, int](client, "sum")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := second.CloseAndRecv(); ErrorCode(err) != CodeResourceExhausted {
+		t.Errorf("sum: expect MaxConnStreams to reject a second stream, output %v", err)
+	}
+	if err := stream.Send(2); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if sum, err := stream.CloseAndRecv(); err != nil || sum != 3 {
+			t.Errorf("sum: expect 3, output %v %v", sum, err)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("the stream is stuck behind the blocked call")
+	}
+	if err := client.Call("add", Struct1{2, 2}, &reply); err != nil || reply != 4 {
+		t.Errorf("add: expect 4 after the stream, output %v %v", reply, err)
+	}
+}
@@ -0,0 +1,270 @@
+package rpc_yqaty
+
+import (
+	"encoding"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type Marshaler interface {
+	MarshalRPC() ([]byte, error)
+}
+
+type Unmarshaler interface {
+	UnmarshalRPC(data []byte) error
+}
+
+var (
+	marshalerTypes = []reflect.Type{
+		reflect.TypeOf((*ObjectMarshaler)(nil)).Elem(),
+		reflect.TypeOf((*Marshaler)(nil)).Elem(),
+		reflect.TypeOf((*json.Marshaler)(nil)).Elem(),
+		reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem(),
+	}
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	timeType            = reflect.TypeOf(time.Time{})
+	durationType        = reflect.TypeOf(time.Duration(0))
+)
+
+type marshalerKind struct {
+	value int
+	ptr   bool
+}
+
+var marshalerCache sync.Map
+
+func lookupMarshaler(t reflect.Type) marshalerKind {
+	if kind, ok := marshalerCache.Load(t); ok {
+		return kind.(marshalerKind)
+	}
+	kind := marshalerKind{value: -1}
+	addr := false
+	for i, iface := range marshalerTypes {
+		if kind.value < 0 && t.Implements(iface) {
+			kind.value = i
+		}
+		if !addr && t.Kind() != reflect.Pointer && reflect.PointerTo(t).Implements(iface) {
+			addr, kind.ptr = true, kind.value < 0
+		}
+	}
+	marshalerCache.Store(t, kind)
+	return kind
+}
+
+func marshaler(data reflect.Value) any {
+	if data.Kind() == reflect.Interface || data.Kind() == reflect.Pointer && data.IsNil() {
+		return nil
+	}
+	kind := lookupMarshaler(data.Type())
+	switch {
+	case kind.ptr && data.CanAddr():
+		return data.Addr().Interface()
+	case kind.value >= 0:
+		return data.Interface()
+	}
+	return nil
+}
+
+func (codec *Encoder) encodeHook(data reflect.Value) (bool, error) {
+	switch data.Type() {
+	case numberType:
+		if data.Len() == 0 {
+			codec.s.WriteString("0")
+			return true, nil
+		}
+		if !validNumber(data.String()) {
+			return true, errors.New("invalid number literal " + strconv.Quote(data.String()))
+		}
+		codec.s.WriteString(data.String())
+		return true, nil
+	case timeType:
+		codec.writeString(data.Interface().(time.Time).Format(time.RFC3339Nano))
+		return true, nil
+	case durationType:
+		var b [20]byte
+		codec.s.Write(strconv.AppendInt(b[:0], data.Int(), 10))
+		return true, nil
+	}
+	var b []byte
+	var err error
+	switch m := marshaler(data).(type) {
+	case ObjectMarshaler:
+		e := &ObjectEncoder{codec: *codec}
+		m.EncodeRPC(e)
+		return true, e.end()
+	case Marshaler:
+		b, err = m.MarshalRPC()
+	case json.Marshaler:
+		b, err = m.MarshalJSON()
+	case encoding.TextMarshaler:
+		if b, err = m.MarshalText(); err == nil {
+			codec.writeString(string(b))
+		}
+		return true, err
+	default:
+		return false, nil
+	}
+	if err == nil {
+		codec.s.Write(b)
+	}
+	return true, err
+}
+
+func (codec *Decoder) decodeString() (string, bool, error) {
+	str, err := codec.Read()
+	if err != nil || str == "null" {
+		return "", false, err
+	}
+	if str[0] != '"' {
+		return str, false, nil
+	}
+	s, err := unquote(str)
+	return s, true, err
+}
+
+func (codec *Decoder) decodeTime() (time.Time, bool, error) {
+	s, quoted, err := codec.decodeString()
+	if err != nil || s == "" && !quoted {
+		return time.Time{}, false, err
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	return t, err == nil, err
+}
+
+func (codec *Decoder) decodeDuration() (time.Duration, bool, error) {
+	s, quoted, err := codec.decodeString()
+	if err != nil || s == "" && !quoted {
+		return 0, false, err
+	}
+	if quoted {
+		d, err := time.ParseDuration(s)
+		return d, err == nil, err
+	}
+	if err := checkNumber(s); err != nil {
+		return 0, false, err
+	}
+	ns, err := strconv.ParseInt(s, 10, 64)
+	return time.Duration(ns), err == nil, err
+}
+
+func (codec *Decoder) decodeHook(data reflect.Value) (bool, error) {
+	if data.Kind() == reflect.Pointer || data.Kind() == reflect.Interface {
+		return false, nil
+	}
+	switch data.Type() {
+	case numberType:
+		s, _, err := codec.decodeString()
+		if err == nil && s != "" {
+			if err = checkNumber(s); err == nil {
+				data.SetString(s)
+			}
+		}
+		return true, err
+	case timeType:
+		t, ok, err := codec.decodeTime()
+		if ok {
+			data.Set(reflect.ValueOf(t))
+		}
+		return true, err
+	case durationType:
+		d, ok, err := codec.decodeDuration()
+		if ok {
+			data.SetInt(int64(d))
+		}
+		return true, err
+	}
+	if !data.CanAddr() {
+		return false, nil
+	}
+	switch u := data.Addr().Interface().(type) {
+	case ObjectUnmarshaler:
+		d := &ObjectDecoder{codec: codec}
+		u.DecodeRPC(d)
+		return true, d.end()
+	case Unmarshaler:
+		raw, err := codec.readRaw()
+		if err != nil {
+			return true, err
+		}
+		return true, u.UnmarshalRPC([]byte(raw))
+	case json.Unmarshaler:
+		raw, err := codec.readRaw()
+		if err != nil {
+			return true, err
+		}
+		return true, u.UnmarshalJSON([]byte(raw))
+	case encoding.TextUnmarshaler:
+		s, quoted, err := codec.decodeString()
+		if err != nil || s == "" && !quoted {
+			return true, err
+		}
+		if !quoted {
+			return true, errors.New("decode failed: expect a string for " + data.Type().String())
+		}
+		return true, u.UnmarshalText([]byte(s))
+	}
+	return false, nil
+}
+
+func mapKey(key reflect.Value) (string, error) {
+	if key.Kind() == reflect.String {
+		return key.String(), nil
+	}
+	if m, ok := key.Interface().(encoding.TextMarshaler); ok {
+		if key.Kind() == reflect.Pointer && key.IsNil() {
+			return "", nil
+		}
+		b, err := m.MarshalText()
+		return string(b), err
+	}
+	switch key.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(key.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(key.Uint(), 10), nil
+	}
+	return "", errors.New("unsupported map key type: " + key.Type().String())
+}
+
+func checkMapKey(t reflect.Type) error {
+	switch t.Kind() {
+	case reflect.String, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return nil
+	}
+	if reflect.PointerTo(t).Implements(textUnmarshalerType) {
+		return nil
+	}
+	return errors.New("unsupported map key type: " + t.String())
+}
+
+func setMapKey(key reflect.Value, s string) error {
+	if key.Kind() == reflect.String {
+		key.SetString(s)
+		return nil
+	}
+	if u, ok := key.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return u.UnmarshalText([]byte(s))
+	}
+	switch key.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(s, 10, key.Type().Bits())
+		if err != nil {
+			return err
+		}
+		key.SetInt(i)
+		return nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		i, err := strconv.ParseUint(s, 10, key.Type().Bits())
+		if err != nil {
+			return err
+		}
+		key.SetUint(i)
+		return nil
+	}
+	return errors.New("unsupported map key type: " + key.Type().String())
+}
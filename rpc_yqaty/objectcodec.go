@@ -0,0 +1,468 @@
+package rpc_yqaty
+
+import (
+	"bytes"
+	"errors"
+	"strconv"
+	"time"
+	"unsafe"
+)
+
+type Signed interface {
+	~int | ~int8 | ~int16 | ~int32 | ~int64
+}
+
+type Unsigned interface {
+	~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64
+}
+
+type Float interface {
+	~float32 | ~float64
+}
+
+type ObjectMarshaler interface {
+	EncodeRPC(e *ObjectEncoder)
+}
+
+type ObjectUnmarshaler interface {
+	DecodeRPC(d *ObjectDecoder)
+}
+
+type ObjectEncoder struct {
+	codec  Encoder
+	fields int
+	err    error
+}
+
+func MarshalObject(v ObjectMarshaler) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	e := &ObjectEncoder{codec: Encoder{buf}}
+	v.EncodeRPC(e)
+	if err := e.end(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (e *ObjectEncoder) key(name string) bool {
+	if e.err != nil {
+		return false
+	}
+	if e.fields == 0 {
+		e.codec.s.WriteByte('{')
+	} else {
+		e.codec.s.WriteByte(',')
+	}
+	e.fields++
+	e.codec.s.WriteByte('"')
+	e.codec.s.WriteString(name)
+	e.codec.s.WriteString("\":")
+	return true
+}
+
+func (e *ObjectEncoder) end() error {
+	if e.err != nil {
+		return e.err
+	}
+	if e.fields == 0 {
+		e.codec.s.WriteByte('{')
+	}
+	e.codec.s.WriteByte('}')
+	return nil
+}
+
+func (e *ObjectEncoder) Value(name string, v any) {
+	if e.key(name) {
+		e.err = e.codec.JSONEncode(v)
+	}
+}
+
+func (e *ObjectEncoder) Fail(err error) {
+	if e.err == nil {
+		e.err = err
+	}
+}
+
+func EncodeString[T ~string](e *ObjectEncoder, name string, v T) {
+	if e.key(name) {
+		e.codec.writeString(string(v))
+	}
+}
+
+func EncodeInt[T Signed](e *ObjectEncoder, name string, v T) {
+	if e.key(name) {
+		var b [20]byte
+		e.codec.s.Write(strconv.AppendInt(b[:0], int64(v), 10))
+	}
+}
+
+func EncodeUint[T Unsigned](e *ObjectEncoder, name string, v T) {
+	if e.key(name) {
+		var b [20]byte
+		e.codec.s.Write(strconv.AppendUint(b[:0], uint64(v), 10))
+	}
+}
+
+func EncodeFloat[T Float](e *ObjectEncoder, name string, v T) {
+	if e.key(name) {
+		e.err = e.codec.writeFloat(float64(v), int(unsafe.Sizeof(v))*8)
+	}
+}
+
+func EncodeBool[T ~bool](e *ObjectEncoder, name string, v T) {
+	if e.key(name) {
+		e.codec.s.WriteString(strconv.FormatBool(bool(v)))
+	}
+}
+
+type ObjectDecoder struct {
+	codec   *Decoder
+	key     string
+	started bool
+	entered bool
+	err     error
+}
+
+func UnmarshalObject(data []byte, v ObjectUnmarshaler) error {
+	d := &ObjectDecoder{codec: newDecoder(bytes.NewReader(data), DecodeLimits{})}
+	v.DecodeRPC(d)
+	return d.end()
+}
+
+func (d *ObjectDecoder) end() error {
+	if d.entered {
+		d.codec.leave()
+		d.entered = false
+	}
+	if d.err == nil && !d.started {
+		d.Skip()
+	}
+	return d.err
+}
+
+func (d *ObjectDecoder) fail(err error) {
+	if d.err == nil {
+		d.err = err
+	}
+}
+
+func (d *ObjectDecoder) read() (string, bool) {
+	if d.err != nil {
+		return "", false
+	}
+	str, err := d.codec.Read()
+	if err != nil {
+		d.fail(err)
+		return "", false
+	}
+	return str, true
+}
+
+func (d *ObjectDecoder) Next() bool {
+	str, ok := d.read()
+	if !ok {
+		return false
+	}
+	if !d.started {
+		d.started = true
+		if str == "null" {
+			return false
+		}
+		if str != "{" {
+			d.fail(errors.New("decode failed"))
+			return false
+		}
+		d.entered = true
+		if err := d.codec.enter(); err != nil {
+			d.fail(err)
+			return false
+		}
+		if str, ok = d.read(); !ok {
+			return false
+		}
+	} else if str == "," {
+		if str, ok = d.read(); !ok {
+			return false
+		}
+	}
+	if str == "}" {
+		return false
+	}
+	key, err := unquote(str)
+	if err != nil {
+		d.fail(err)
+		return false
+	}
+	if err := d.codec.consume(":"); err != nil {
+		d.fail(err)
+		return false
+	}
+	d.key = key
+	return true
+}
+
+func (d *ObjectDecoder) Key() string {
+	return d.key
+}
+
+func (d *ObjectDecoder) Value(v any) {
+	if d.err == nil {
+		d.fail(d.codec.JSONDecode(v))
+	}
+}
+
+func (d *ObjectDecoder) Skip() {
+	if d.err == nil {
+		_, err := d.codec.readRaw()
+		d.fail(err)
+	}
+}
+
+func (d *ObjectDecoder) Fail(err error) {
+	d.fail(err)
+}
+
+func (d *ObjectDecoder) scalar() (string, bool) {
+	str, ok := d.read()
+	if !ok || str == "null" {
+		return "", false
+	}
+	if str[0] == '"' {
+		str = str[1 : len(str)-1]
+	}
+	return str, true
+}
+
+func DecodeString[T ~string](d *ObjectDecoder, p *T) {
+	str, ok := d.read()
+	if !ok || str == "null" {
+		return
+	}
+	if str[0] != '"' {
+		d.fail(errors.New("decode failed"))
+		return
+	}
+	s, err := unquote(str)
+	if err != nil {
+		d.fail(err)
+		return
+	}
+	*p = T(s)
+}
+
+func DecodeInt[T Signed](d *ObjectDecoder, p *T) {
+	str, ok := d.scalar()
+	if !ok {
+		return
+	}
+	if err := checkNumber(str); err != nil {
+		d.fail(err)
+		return
+	}
+	i, err := strconv.ParseInt(str, 10, int(unsafe.Sizeof(*p))*8)
+	if err != nil {
+		d.fail(err)
+		return
+	}
+	*p = T(i)
+}
+
+func DecodeUint[T Unsigned](d *ObjectDecoder, p *T) {
+	str, ok := d.scalar()
+	if !ok {
+		return
+	}
+	if err := checkNumber(str); err != nil {
+		d.fail(err)
+		return
+	}
+	i, err := strconv.ParseUint(str, 10, int(unsafe.Sizeof(*p))*8)
+	if err != nil {
+		d.fail(err)
+		return
+	}
+	*p = T(i)
+}
+
+func DecodeFloat[T Float](d *ObjectDecoder, p *T) {
+	str, ok := d.scalar()
+	if !ok {
+		return
+	}
+	if err := checkNumber(str); err != nil {
+		d.fail(err)
+		return
+	}
+	f, err := strconv.ParseFloat(str, int(unsafe.Sizeof(*p))*8)
+	if err != nil {
+		d.fail(err)
+		return
+	}
+	*p = T(f)
+}
+
+func DecodeBool[T ~bool](d *ObjectDecoder, p *T) {
+	str, ok := d.scalar()
+	if !ok {
+		return
+	}
+	b, err := strconv.ParseBool(str)
+	if err != nil {
+		d.fail(err)
+		return
+	}
+	*p = T(b)
+}
+
+func DecodeTime(d *ObjectDecoder, p *time.Time) {
+	if d.err != nil {
+		return
+	}
+	t, ok, err := d.codec.decodeTime()
+	if ok {
+		*p = t
+	}
+	d.fail(err)
+}
+
+func DecodeDuration(d *ObjectDecoder, p *time.Duration) {
+	if d.err != nil {
+		return
+	}
+	v, ok, err := d.codec.decodeDuration()
+	if ok {
+		*p = v
+	}
+	d.fail(err)
+}
+
+func DecodeObject(d *ObjectDecoder, v ObjectUnmarshaler) {
+	if d.err != nil {
+		return
+	}
+	nested := &ObjectDecoder{codec: d.codec}
+	v.DecodeRPC(nested)
+	d.fail(nested.end())
+}
+
+func DecodePointer[T any](d *ObjectDecoder, p **T, elem func(d *ObjectDecoder, p *T)) {
+	if d.err != nil {
+		return
+	}
+	str, err := d.codec.peek()
+	if err != nil {
+		d.fail(err)
+		return
+	}
+	if str == "null" {
+		d.codec.Read()
+		*p = nil
+		return
+	}
+	elem(d, Alloc(p))
+}
+
+func (d *ObjectDecoder) open(delim string) bool {
+	str, ok := d.read()
+	if !ok || str == "null" {
+		return false
+	}
+	if str != delim {
+		d.fail(errors.New("decode failed"))
+		return false
+	}
+	if err := d.codec.enter(); err != nil {
+		d.fail(err)
+		return false
+	}
+	return true
+}
+
+func (d *ObjectDecoder) more(n int, end string) bool {
+	str, ok := d.read()
+	if !ok || str == end {
+		return false
+	}
+	if n == 0 {
+		d.codec.unread(str)
+	} else if str != "," {
+		d.fail(errors.New("decode failed"))
+		return false
+	}
+	if limit := d.codec.limits.MaxCollection; limit > 0 && n >= limit {
+		d.fail(d.codec.fail(errCollectionTooLong))
+		return false
+	}
+	return true
+}
+
+func DecodeSlice[T any](d *ObjectDecoder, p *[]T, elem func(d *ObjectDecoder, p *T)) {
+	if d.err != nil {
+		return
+	}
+	if str, err := d.codec.peek(); err == nil && str == "null" {
+		d.codec.Read()
+		*p = nil
+		return
+	}
+	if !d.open("[") {
+		return
+	}
+	defer d.codec.leave()
+	slice := make([]T, 0)
+	for d.more(len(slice), "]") {
+		var v T
+		if elem(d, &v); d.err != nil {
+			return
+		}
+		slice = append(slice, v)
+	}
+	if d.err == nil {
+		*p = slice
+	}
+}
+
+func DecodeMap[V any](d *ObjectDecoder, p *map[string]V, elem func(d *ObjectDecoder, p *V)) {
+	if d.err != nil {
+		return
+	}
+	if str, err := d.codec.peek(); err == nil && str == "null" {
+		d.codec.Read()
+		*p = nil
+		return
+	}
+	if !d.open("{") {
+		return
+	}
+	defer d.codec.leave()
+	if *p == nil {
+		*p = make(map[string]V)
+	}
+	for n := 0; d.more(n, "}"); n++ {
+		str, ok := d.read()
+		if !ok {
+			return
+		}
+		key, err := unquote(str)
+		if err != nil {
+			d.fail(err)
+			return
+		}
+		if err := d.codec.consume(":"); err != nil {
+			d.fail(err)
+			return
+		}
+		var v V
+		if elem(d, &v); d.err != nil {
+			return
+		}
+		(*p)[key] = v
+	}
+}
+
+func Alloc[T any](p **T) *T {
+	if *p == nil {
+		*p = new(T)
+	}
+	return *p
+}
@@ -0,0 +1,181 @@
+package rpc_yqaty
+
+import (
+	"math"
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+type RateKey int
+
+const (
+	RateGlobal RateKey = iota
+	RateByPeer
+	RateByPrincipal
+	RateByMethod
+)
+
+type RateLimit struct {
+	Key   RateKey
+	Match string
+	Rate  float64
+	Burst int
+}
+
+type RateStatus struct {
+	Key    RateKey
+	Name   string
+	Tokens float64
+	Rate   float64
+	Burst  int
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+type rateLimiter struct {
+	limit   RateLimit
+	mutex   sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+func (limiter *rateLimiter) bucket(name string, now time.Time) *tokenBucket {
+	b, ok := limiter.buckets[name]
+	if !ok {
+		if len(limiter.buckets) >= 1024 {
+			limiter.prune(now)
+		}
+		b = &tokenBucket{tokens: float64(limiter.limit.Burst), last: now}
+		limiter.buckets[name] = b
+	}
+	b.tokens = math.Min(float64(limiter.limit.Burst), b.tokens+now.Sub(b.last).Seconds()*limiter.limit.Rate)
+	b.last = now
+	return b
+}
+
+func (limiter *rateLimiter) prune(now time.Time) {
+	for name, b := range limiter.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*limiter.limit.Rate >= float64(limiter.limit.Burst) {
+			delete(limiter.buckets, name)
+		}
+	}
+}
+
+func (limiter *rateLimiter) take(name string, now time.Time) time.Duration {
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+	b := limiter.bucket(name, now)
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0
+	}
+	if limiter.limit.Rate <= 0 {
+		return time.Duration(math.MaxInt64)
+	}
+	return time.Duration((1 - b.tokens) / limiter.limit.Rate * float64(time.Second))
+}
+
+func (limiter *rateLimiter) refund(name string) {
+	limiter.mutex.Lock()
+	if b, ok := limiter.buckets[name]; ok {
+		b.tokens = math.Min(float64(limiter.limit.Burst), b.tokens+1)
+	}
+	limiter.mutex.Unlock()
+}
+
+func (server *Server) AddRateLimit(limit RateLimit) {
+	server.rateMutex.Lock()
+	server.limiters = append(server.limiters, &rateLimiter{limit: limit, buckets: make(map[string]*tokenBucket)})
+	server.rateMutex.Unlock()
+}
+
+func (server *Server) RateLimits() []RateStatus {
+	server.rateMutex.RLock()
+	defer server.rateMutex.RUnlock()
+	now := time.Now()
+	var status []RateStatus
+	for _, limiter := range server.limiters {
+		limiter.mutex.Lock()
+		names := make([]string, 0, len(limiter.buckets))
+		for name := range limiter.buckets {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			b := limiter.bucket(name, now)
+			status = append(status, RateStatus{Key: limiter.limit.Key, Name: name, Tokens: b.tokens, Rate: limiter.limit.Rate, Burst: limiter.limit.Burst})
+		}
+		limiter.mutex.Unlock()
+	}
+	return status
+}
+
+func (server *Server) authenticate(peer string, principal string) (string, error) {
+	if server.Authenticate == nil {
+		return "", nil
+	}
+	principal, err := server.Authenticate(peer, principal)
+	if err != nil {
+		if _, ok := err.(*Error); !ok {
+			err = &Error{Code: CodeUnauthenticated, Message: err.Error()}
+		}
+		return "", err
+	}
+	return principal, nil
+}
+
+func (server *Server) allow(peer string, principal string, method string) error {
+	principal, err := server.authenticate(peer, principal)
+	if err != nil {
+		return err
+	}
+	server.rateMutex.RLock()
+	defer server.rateMutex.RUnlock()
+	now := time.Now()
+	var taken []*rateLimiter
+	var names []string
+	for _, limiter := range server.limiters {
+		var name string
+		switch limiter.limit.Key {
+		case RateByPeer:
+			name = peer
+		case RateByPrincipal:
+			name = principal
+			if name == "" {
+				name = peer
+			}
+		case RateByMethod:
+			name = method
+		}
+		if limiter.limit.Match != "" && limiter.limit.Match != name {
+			continue
+		}
+		if wait := limiter.take(name, now); wait > 0 {
+			for i := range taken {
+				taken[i].refund(names[i])
+			}
+			return &Error{Code: CodeResourceExhausted, Message: "rate limit exceeded", RetryAfter: wait}
+		}
+		taken = append(taken, limiter)
+		names = append(names, name)
+	}
+	return nil
+}
+
+func peerHost(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
+
+func connPeer(conn any) string {
+	if c, ok := conn.(interface{ RemoteAddr() net.Addr }); ok && c.RemoteAddr() != nil {
+		return peerHost(c.RemoteAddr().String())
+	}
+	return ""
+}
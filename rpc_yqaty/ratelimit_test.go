@@ -0,0 +1,66 @@
+package rpc_yqaty
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRateLimit(t *testing.T) {
+	server := GetServer()
+	server.Register("add", (*Func).Add)
+	server.Register("sleep", (*Func).Sleep)
+	server.AddRateLimit(RateLimit{Key: RateByPrincipal, Rate: 0.5, Burst: 1})
+	server.AddRateLimit(RateLimit{Key: RateByMethod, Match: "sleep", Rate: 1000, Burst: 1000})
+	server.Authenticate = func(peer string, principal string) (string, error) {
+		if name, ok := strings.CutPrefix(principal, "token-"); ok {
+			return name, nil
+		}
+		return "", nil
+	}
+	addr := serve(t, server)
+	alice, bob, mallory := GetClient(), GetClient(), GetClient()
+	alice.Principal, bob.Principal = "token-alice", "token-bob"
+	for _, client := range []*Client{alice, bob, mallory} {
+		if err := client.Dial(addr); err != nil {
+			t.Fatal(err)
+		}
+		defer client.Close()
+	}
+
+	if err := alice.Call("add", Struct1{1, 2}, new(int)); err != nil {
+		t.Fatal(err)
+	}
+	err := alice.Call("add", Struct1{1, 2}, new(int))
+	if ErrorCode(err) != CodeResourceExhausted {
+		t.Fatalf("expect code %v, output %v", CodeResourceExhausted, err)
+	}
+	if e := err.(*Error); e.RetryAfter <= 0 || e.RetryAfter > 2*time.Second {
+		t.Errorf("expect retry after in (0, 2s], output %v", e.RetryAfter)
+	}
+	if err := bob.Call("add", Struct1{1, 2}, new(int)); err != nil {
+		t.Errorf("bob: expect no error, output %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		mallory.Principal = "alice" + strconv.Itoa(i)
+		err = mallory.Call("add", Struct1{1, 2}, new(int))
+	}
+	if ErrorCode(err) != CodeResourceExhausted {
+		t.Errorf("mallory: expect unverified principals to share the peer bucket, output %v", err)
+	}
+
+	status := server.RateLimits()
+	if len(status) != 3 || status[0].Name != "127.0.0.1" || status[1].Name != "alice" || status[2].Name != "bob" || status[1].Tokens >= 1 {
+		t.Errorf("unexpected rate status %+v", status)
+	}
+
+	server.Authenticate = func(peer string, principal string) (string, error) {
+		return "", errors.New("bad token")
+	}
+	if err := bob.Call("add", Struct1{1, 2}, new(int)); ErrorCode(err) != CodeUnauthenticated {
+		t.Errorf("expect code %v, output %v", CodeUnauthenticated, err)
+	}
+}
@@ -0,0 +1,69 @@
+package rpc_yqaty
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+)
+
+type RetryPolicy struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Multiplier     float64
+	RetryCodes     []Code
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    3,
+	InitialBackoff: 50 * time.Millisecond,
+	MaxBackoff:     time.Second,
+	Multiplier:     2,
+	RetryCodes:     []Code{CodeUnavailable, CodeDeadlineExceeded},
+}
+
+func (policy *RetryPolicy) retryable(err error, attempt int) bool {
+	if attempt >= policy.MaxAttempts {
+		return false
+	}
+	code := ErrorCode(err)
+	for _, c := range policy.RetryCodes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+func (policy *RetryPolicy) backoff(attempt int) time.Duration {
+	backoff := float64(policy.InitialBackoff)
+	for i := 1; i < attempt; i++ {
+		if policy.Multiplier > 1 {
+			backoff *= policy.Multiplier
+		}
+	}
+	if policy.MaxBackoff > 0 && backoff > float64(policy.MaxBackoff) {
+		return policy.MaxBackoff
+	}
+	return time.Duration(backoff)
+}
+
+func (client *Client) MarkIdempotent(names ...string) {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+	for _, name := range names {
+		client.idempotent[name] = true
+	}
+}
+
+func (client *Client) isIdempotent(name string) bool {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+	return client.idempotent[name]
+}
+
+func newIdempotencyKey() string {
+	key := make([]byte, 16)
+	rand.Read(key)
+	return hex.EncodeToString(key)
+}
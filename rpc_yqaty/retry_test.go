@@ -0,0 +1,86 @@
+package rpc_yqaty
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+var (
+	attemptMutex sync.Mutex
+	attempts     int
+)
+
+func (f *Func) Flaky(A Struct1, B *int) error {
+	attemptMutex.Lock()
+	defer attemptMutex.Unlock()
+	attempts++
+	if attempts <= A.A {
+		return &Error{Code: CodeUnavailable, Message: "try again"}
+	}
+	*B = attempts
+	return nil
+}
+
+func TestRetry(t *testing.T) {
+	server := GetServer()
+	server.Register("flaky", (*Func).Flaky)
+	server.DedupWindow = time.Minute
+	client := GetClient()
+	if err := client.Dial(serve(t, server)); err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	client.Retry = DefaultRetryPolicy
+	client.Retry.InitialBackoff = time.Millisecond
+	cached := func(key string) (int, bool) {
+		server.dedup.mutex.Lock()
+		defer server.dedup.mutex.Unlock()
+		_, ok := server.dedup.entries["flaky\x00"+key]
+		return len(server.dedup.entries), ok
+	}
+
+	attempts = 0
+	if err := client.Call("flaky", Struct1{1, 0}, new(int)); ErrorCode(err) != CodeUnavailable {
+		t.Errorf("expect no retry for a non idempotent method, output %v", err)
+	}
+	if n, _ := cached(""); n != 0 {
+		t.Errorf("expect no idempotency key for a non idempotent method, output %d cached replies", n)
+	}
+
+	client.MarkIdempotent("flaky")
+	attempts = 0
+	var reply int
+	if err := client.Call("flaky", Struct1{2, 0}, &reply); err != nil || reply != 3 {
+		t.Errorf("expect 3 attempts, output %v %v", reply, err)
+	}
+	attempts = 0
+	if err := client.Call("flaky", Struct1{5, 0}, &reply); ErrorCode(err) != CodeUnavailable || attempts != 3 {
+		t.Errorf("expect to give up after 3 attempts, output %v %v", attempts, err)
+	}
+
+	attempts = 0
+	var first, second int
+	if err := client.call("flaky", "key", Struct1{}, &first); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.call("flaky", "key", Struct1{}, &second); err != nil {
+		t.Fatal(err)
+	}
+	if first != 1 || second != 1 || attempts != 1 {
+		t.Errorf("expect the duplicate to be answered from the cache, output %v %v %v", first, second, attempts)
+	}
+
+	server.MaxDedupEntries = 2
+	for _, key := range []string{"a", "b", "c"} {
+		if err := client.call("flaky", key, Struct1{}, &first); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n, ok := cached("a"); n != 2 || ok {
+		t.Errorf("expect the oldest reply to be evicted, output %d cached replies", n)
+	}
+	if err := client.call("flaky", "a", Struct1{}, &first); err != nil || first != 5 {
+		t.Errorf("expect an evicted key to run again, output %v %v", first, err)
+	}
+}
@@ -1,32 +1,65 @@
 package rpc_yqaty
 
 import (
-	"bytes"
 	"errors"
+	"fmt"
 	"go/token"
 	"io"
 	"net"
 	"reflect"
 	"sync"
-	"text/scanner"
 	"time"
 )
 
 type MethodType struct {
-	Method    reflect.Type
-	ArgsType  reflect.Type
-	ReplyType reflect.Type
-	Value     reflect.Value
+	Method       reflect.Type
+	ArgsType     reflect.Type
+	ReplyType    reflect.Type
+	Value        reflect.Value
+	ClientStream bool
+	ServerStream bool
+	Executor     Executor
+	Ordered      bool
+	Cache        *responseCache
+}
+
+type MethodOption func(method *MethodType)
+
+func WithExecutor(executor Executor) MethodOption {
+	return func(method *MethodType) {
+		method.Executor = executor
+	}
+}
+
+func Ordered() MethodOption {
+	return func(method *MethodType) {
+		method.Ordered = true
+	}
+}
+
+func (method *MethodType) streaming() bool {
+	return method.ClientStream || method.ServerStream
 }
 
 type Request struct {
-	MethodName string
-	Seq        uint64
+	MethodName     string
+	Seq            uint64
+	Frame          int
+	Credit         uint64
+	Stream         bool
+	Principal      string
+	IdempotencyKey string
+	Compression    string
 }
 
 type Response struct {
-	Seq   uint64
-	Error string
+	Seq         uint64
+	Error       string
+	Code        Code
+	RetryAfter  int64
+	Frame       int
+	Credit      uint64
+	Compression string
 }
 
 type Data struct {
@@ -34,30 +67,29 @@ type Data struct {
 }
 
 type ServerCodec struct {
-	conn    io.ReadWriteCloser
-	encoder *Encoder
-	decoder *Decoder
+	conn        io.ReadWriteCloser
+	writer      *messageWriter
+	decoder     *Decoder
+	compression string
 }
 
 func (scodec *ServerCodec) ReadRequestHeader(req *Request) error {
-	return scodec.decoder.JSONDecode(req)
+	scodec.decoder.begin()
+	err := scodec.decoder.JSONDecode(req)
+	scodec.compression = req.Compression
+	return err
 }
 
 func (scodec *ServerCodec) ReadRequestBody(data any) error {
-	return scodec.decoder.JSONDecode(data)
+	return scodec.decoder.decodeBody(scodec.compression, data)
 }
 
 func (scodec *ServerCodec) WriteResponse(resp *Response, data *Data) error {
-	scodec.encoder.s = new(bytes.Buffer)
-	if err := scodec.encoder.JSONEncode(resp); err != nil {
-		return err
+	err := scodec.writer.write(resp, &resp.Compression, data)
+	if errors.Is(err, errBrokenStream) {
+		scodec.conn.Close()
 	}
-	if err := scodec.encoder.JSONEncode(data); err != nil {
-		return err
-	}
-	scodec.encoder.s.WriteString(" ")
-	scodec.conn.Write(scodec.encoder.s.Bytes())
-	return nil
+	return err
 }
 
 func (scodec *ServerCodec) Close() {
@@ -65,7 +97,27 @@ func (scodec *ServerCodec) Close() {
 }
 
 type Server struct {
-	Mp map[string]*MethodType
+	Mp                map[string]*MethodType
+	MaxConnRequests   int
+	MaxServerRequests int
+	MaxConnStreams    int
+	MaxServerStreams  int
+	LimitPolicy       LimitPolicy
+	Executor          Executor
+	DedupWindow       time.Duration
+	MaxDedupEntries   int
+	IdleTimeout       time.Duration
+	Features          []string
+	CompressThreshold int
+	Limits            DecodeLimits
+	AllowedOrigins    []string
+	Authenticate      func(peer string, principal string) (string, error)
+	once              sync.Once
+	inflight          semaphore
+	streaming         semaphore
+	rateMutex         sync.RWMutex
+	limiters          []*rateLimiter
+	dedup             dedupCache
 }
 
 func IsExportedOrBulitinType(t reflect.Type) bool {
@@ -75,7 +127,7 @@ func IsExportedOrBulitinType(t reflect.Type) bool {
 	return token.IsExported(t.Name()) || t.PkgPath() == ""
 }
 
-func (server *Server) Register(name string, method any) error {
+func (server *Server) Register(name string, method any, opts ...MethodOption) error {
 	methodtype := reflect.TypeOf(method)
 	if methodtype.Kind() != reflect.Func {
 		return errors.New("register: the second parameter should be a method")
@@ -83,7 +135,9 @@ func (server *Server) Register(name string, method any) error {
 	if methodtype.NumIn() != 3 {
 		return errors.New("register: needs exactly 3 parameter")
 	}
-	if methodtype.In(2).Kind() != reflect.Pointer {
+	clientStream := reflect.PointerTo(methodtype.In(1)).Implements(receiverBinderType)
+	serverStream := reflect.PointerTo(methodtype.In(2)).Implements(senderBinderType)
+	if !serverStream && methodtype.In(2).Kind() != reflect.Pointer {
 		return errors.New("register: reply type needs to be a pointer")
 	}
 	if !IsExportedOrBulitinType(methodtype.In(2)) {
@@ -99,89 +153,252 @@ func (server *Server) Register(name string, method any) error {
 	if ok {
 		return errors.New("register: the name has been registered")
 	}
-	server.Mp[name] = &MethodType{methodtype, methodtype.In(1), methodtype.In(2), reflect.ValueOf(method)}
+	mtype := &MethodType{Method: methodtype, ArgsType: methodtype.In(1), ReplyType: methodtype.In(2), Value: reflect.ValueOf(method), ClientStream: clientStream, ServerStream: serverStream}
+	for _, opt := range opts {
+		opt(mtype)
+	}
+	if mtype.Ordered && mtype.streaming() {
+		return errors.New("register: streaming methods can not be ordered")
+	}
+	if mtype.Cache != nil && mtype.streaming() {
+		return errors.New("register: streaming methods can not be cached")
+	}
+	server.Mp[name] = mtype
 	return nil
 }
 
-func (server *Server) SendResponse(codec ServerCodec, sending *sync.Mutex, resp *Response, data *Data) {
-	sending.Lock()
-	codec.WriteResponse(resp, data)
-	sending.Unlock()
+type serverConn struct {
+	codec     ServerCodec
+	sending   sync.Mutex
+	wg        sync.WaitGroup
+	mutex     sync.Mutex
+	streams   map[uint64]*serverStream
+	calls     map[uint64]bool
+	queues    map[string]*serialQueue
+	inflight  semaphore
+	streaming semaphore
+	peer      string
+	protocol  Hello
+}
+
+func (conn *serverConn) send(resp *Response, data *Data) error {
+	conn.sending.Lock()
+	defer conn.sending.Unlock()
+	return conn.codec.WriteResponse(resp, data)
 }
 
-func (server *Server) call(fun reflect.Value, rcvr reflect.Value, args reflect.Value, reply reflect.Value, rerrors *[]reflect.Value, flag chan struct{}, A *int) {
-	*rerrors = fun.Call([]reflect.Value{rcvr, args, reply})
-	flag <- struct{}{}
+func (conn *serverConn) openCall(seq uint64) {
+	conn.mutex.Lock()
+	conn.calls[seq] = false
+	conn.mutex.Unlock()
 }
 
-func (server *Server) DealRequest(codec ServerCodec, sending *sync.Mutex, wg *sync.WaitGroup, req *Request, args reflect.Value) {
-	defer wg.Done()
-	method := server.Mp[req.MethodName]
-	fun := method.Value
+func (conn *serverConn) cancelCall(seq uint64) {
+	conn.mutex.Lock()
+	if _, ok := conn.calls[seq]; ok {
+		conn.calls[seq] = true
+	}
+	conn.mutex.Unlock()
+}
+
+func (conn *serverConn) canceled(seq uint64) bool {
+	conn.mutex.Lock()
+	defer conn.mutex.Unlock()
+	return conn.calls[seq]
+}
+
+func (conn *serverConn) closeCall(seq uint64) {
+	conn.mutex.Lock()
+	delete(conn.calls, seq)
+	conn.mutex.Unlock()
+}
+
+func (server *Server) SendResponse(conn *serverConn, resp *Response, data *Data) error {
+	return conn.send(resp, data)
+}
+
+func (server *Server) invoke(method *MethodType, args reflect.Value) (reflect.Value, error) {
+	if method.streaming() {
+		return reflect.Value{}, &Error{Code: CodeInvalidArgument, Message: "the method can only be called as a stream"}
+	}
 	reply := reflect.New(method.ReplyType.Elem())
 	rcvr := reflect.New(method.Method.In(0).Elem())
-	flag := make(chan struct{})
-	var rerrors []reflect.Value
-	go server.call(fun, rcvr, args, reply, &rerrors, flag, new(int))
-	select {
-	case <-time.After(5 * time.Second):
-		server.SendResponse(codec, sending, &Response{req.Seq, "TLE!"}, &Data{nil})
-		return
-	case <-flag:
-		break
+	return reply, callMethod(method, []reflect.Value{rcvr, args, reply})
+}
+
+func callMethod(method *MethodType, in []reflect.Value) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &Error{Code: CodeInternal, Message: fmt.Sprintf("panic: %v", r)}
+		}
+	}()
+	err, _ = method.Value.Call(in)[0].Interface().(error)
+	return err
+}
+
+func (server *Server) invokeTimeout(name string, key string, method *MethodType, args reflect.Value) (reflect.Value, error) {
+	type result struct {
+		reply reflect.Value
+		err   error
 	}
-	var err error
-	if rerrors[0].Interface() != nil {
-		err = rerrors[0].Interface().(error)
+	flag := make(chan result, 1)
+	go func() {
+		reply, err := server.invokeKey(name, key, method, args)
+		flag <- result{reply, err}
+	}()
+	select {
+	case <-time.After(callTimeout):
+		return reflect.Value{}, errTimeout
+	case res := <-flag:
+		return res.reply, res.err
 	}
-	if err != nil {
-		server.SendResponse(codec, sending, &Response{req.Seq, err.Error()}, &Data{nil})
+}
+
+func (server *Server) DealRequest(conn *serverConn, req *Request, args reflect.Value) {
+	defer conn.wg.Done()
+	defer server.release(conn.inflight)
+	defer conn.closeCall(req.Seq)
+	if conn.canceled(req.Seq) {
 		return
 	}
-	server.SendResponse(codec, sending, &Response{req.Seq, ""}, &Data{reply.Interface()})
+	var once sync.Once
+	timer := time.AfterFunc(callTimeout, func() {
+		once.Do(func() {
+			server.SendResponse(conn, errorResponse(req.Seq, errTimeout), &Data{nil})
+		})
+	})
+	reply, err := server.invokeKey(req.MethodName, req.IdempotencyKey, server.Mp[req.MethodName], args)
+	timer.Stop()
+	once.Do(func() {
+		if conn.canceled(req.Seq) {
+			return
+		}
+		if err != nil {
+			server.SendResponse(conn, errorResponse(req.Seq, err), &Data{nil})
+			return
+		}
+		if err := server.SendResponse(conn, &Response{Seq: req.Seq}, &Data{reply.Interface()}); err != nil {
+			server.SendResponse(conn, errorResponse(req.Seq, &Error{Code: CodeInternal, Message: err.Error()}), &Data{nil})
+		}
+	})
 }
 
 func (server *Server) ServeConn(codec ServerCodec) {
-	sending := new(sync.Mutex)
-	wg := new(sync.WaitGroup)
+	conn := &serverConn{codec: codec, streams: make(map[uint64]*serverStream), calls: make(map[uint64]bool), queues: make(map[string]*serialQueue), inflight: newSemaphore(server.MaxConnRequests), streaming: newSemaphore(server.MaxConnStreams), peer: connPeer(codec.conn)}
+	deadline, _ := conn.codec.conn.(interface{ SetReadDeadline(time.Time) error })
 	for {
+		if deadline != nil && server.IdleTimeout > 0 {
+			deadline.SetReadDeadline(time.Now().Add(server.IdleTimeout))
+		}
 		var req Request
-		err := codec.ReadRequestHeader(&req)
+		err := conn.codec.ReadRequestHeader(&req)
 		if err != nil {
 			if err == io.EOF {
 				break
-			} else {
-				codec.ReadRequestBody(nil)
-				server.SendResponse(codec, sending, &Response{req.Seq, err.Error()}, &Data{nil})
-				continue
 			}
+			if conn.codec.decoder.Err() != nil {
+				server.SendResponse(conn, errorResponse(req.Seq, err), &Data{nil})
+				break
+			}
+			conn.codec.ReadRequestBody(nil)
+			server.SendResponse(conn, errorResponse(req.Seq, &Error{Code: CodeInvalidArgument, Message: err.Error()}), &Data{nil})
+			continue
+		}
+		if req.Frame == FrameHello {
+			if err := server.handshake(conn, &req); err != nil {
+				break
+			}
+			continue
+		}
+		if req.Frame != FrameCall {
+			if err := conn.control(&req); err != nil {
+				break
+			}
+			continue
 		}
 		method, ok := server.Mp[req.MethodName]
 		if !ok {
-			codec.ReadRequestBody(nil)
-			server.SendResponse(codec, sending, &Response{req.Seq, "the name has not been register"}, &Data{nil})
+			conn.codec.ReadRequestBody(nil)
+			server.SendResponse(conn, errorResponse(req.Seq, errNotRegistered), &Data{nil})
+			continue
+		}
+		if method.streaming() != req.Stream {
+			conn.codec.ReadRequestBody(nil)
+			server.SendResponse(conn, errorResponse(req.Seq, &Error{Code: CodeInvalidArgument, Message: "the call does not match the method kind"}), &Data{nil})
 			continue
 		}
 		args := reflect.New(method.ArgsType)
-		err = codec.ReadRequestBody(args.Interface())
+		if method.ClientStream {
+			err = conn.codec.ReadRequestBody(nil)
+		} else {
+			err = conn.codec.ReadRequestBody(args.Interface())
+		}
 		if err != nil {
 			if err == io.EOF {
 				break
+			}
+			if conn.codec.decoder.Err() != nil {
+				server.SendResponse(conn, errorResponse(req.Seq, err), &Data{nil})
+				break
+			}
+			server.SendResponse(conn, errorResponse(req.Seq, &Error{Code: CodeInvalidArgument, Message: err.Error()}), &Data{nil})
+			continue
+		}
+		if err := server.allow(conn.peer, req.Principal, req.MethodName); err != nil {
+			server.SendResponse(conn, errorResponse(req.Seq, err), &Data{nil})
+			continue
+		}
+		acquired := false
+		if method.streaming() {
+			acquired = server.acquireStream(conn.streaming)
+		} else {
+			acquired = server.acquire(conn.inflight, false)
+			if !acquired && server.LimitPolicy == LimitBlock {
+				stop := conn.keepalive()
+				acquired = server.acquire(conn.inflight, true)
+				stop()
+			}
+		}
+		if !acquired {
+			server.SendResponse(conn, errorResponse(req.Seq, errResourceExhausted), &Data{nil})
+			continue
+		}
+		conn.wg.Add(1)
+		if !method.streaming() {
+			conn.openCall(req.Seq)
+		}
+		task := func() {
+			server.DealRequest(conn, &req, args.Elem())
+		}
+		if method.streaming() {
+			stream := conn.openStream(&req, method)
+			task = func() {
+				server.dealStream(conn, &req, method, args.Elem(), stream)
+			}
+		}
+		executor := server.executor(method)
+		if method.Ordered {
+			executor = conn.queue(req.MethodName)
+		}
+		if err := executor.Execute(task); err != nil {
+			if method.streaming() {
+				conn.closeStream(req.Seq)
+				server.releaseStream(conn.streaming)
 			} else {
-				server.SendResponse(codec, sending, &Response{req.Seq, err.Error()}, &Data{nil})
-				continue
+				conn.closeCall(req.Seq)
+				server.release(conn.inflight)
 			}
+			conn.wg.Done()
+			server.SendResponse(conn, errorResponse(req.Seq, err), &Data{nil})
 		}
-		wg.Add(1)
-		go server.DealRequest(codec, sending, wg, &req, args.Elem())
 	}
-	wg.Wait()
-	codec.Close()
+	conn.cancelStreams()
+	conn.wg.Wait()
+	conn.codec.Close()
 }
 
 func (server *Server) InitCodec(conn io.ReadWriteCloser) {
-	codec := ServerCodec{conn: conn, decoder: &Decoder{&scanner.Scanner{}}, encoder: &Encoder{&bytes.Buffer{}}}
-	codec.decoder.s.Init(conn)
+	codec := ServerCodec{conn: conn, decoder: newDecoder(conn, server.Limits), writer: newMessageWriter(conn)}
 	server.ServeConn(codec)
 }
 
@@ -190,6 +407,10 @@ func (server *Server) Accept(addr string) error {
 	if err != nil {
 		return err
 	}
+	return server.Serve(lis)
+}
+
+func (server *Server) Serve(lis net.Listener) error {
 	for {
 		conn, err := lis.Accept()
 		if err != nil {
@@ -0,0 +1,84 @@
+package rpc_yqaty
+
+import (
+	"sync"
+	"time"
+)
+
+type flightCall struct {
+	done    chan struct{}
+	data    string
+	err     error
+	expires time.Time
+}
+
+type flightGroup struct {
+	mutex sync.Mutex
+	calls map[string]*flightCall
+}
+
+func (group *flightGroup) do(key string, ttl time.Duration, fn func() (string, error)) (string, bool, error) {
+	group.mutex.Lock()
+	if group.calls == nil {
+		group.calls = make(map[string]*flightCall)
+	}
+	now := time.Now()
+	if call, ok := group.calls[key]; ok && (call.expires.IsZero() || call.expires.After(now)) {
+		group.mutex.Unlock()
+		<-call.done
+		return call.data, true, call.err
+	}
+	if len(group.calls) >= 1024 {
+		for k, call := range group.calls {
+			if !call.expires.IsZero() && !call.expires.After(now) {
+				delete(group.calls, k)
+			}
+		}
+	}
+	call := &flightCall{done: make(chan struct{})}
+	group.calls[key] = call
+	group.mutex.Unlock()
+
+	call.data, call.err = fn()
+	group.mutex.Lock()
+	if call.err != nil || ttl <= 0 {
+		delete(group.calls, key)
+	} else {
+		call.expires = time.Now().Add(ttl)
+	}
+	group.mutex.Unlock()
+	close(call.done)
+	return call.data, false, call.err
+}
+
+func (client *Client) Collapse(ttl time.Duration, names ...string) {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+	for _, name := range names {
+		client.collapse[name] = ttl
+	}
+}
+
+func (client *Client) collapsed(name string) (time.Duration, bool) {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+	ttl, ok := client.collapse[name]
+	return ttl, ok
+}
+
+func (client *Client) callShared(name string, args any, reply any, ttl time.Duration) error {
+	encoded, err := Marshal(args)
+	if err != nil {
+		return err
+	}
+	data, shared, err := client.flights.do(name+"\x00"+encoded, ttl, func() (string, error) {
+		if err := client.callRetry(name, args, reply); err != nil {
+			return "", err
+		}
+		return Marshal(reply)
+	})
+	if err != nil || !shared {
+		return err
+	}
+	return UnMarshal(data, reply)
+}
@@ -0,0 +1,59 @@
+package rpc_yqaty
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var counted int32
+
+func (f *Func) Counted(A Struct1, B *int) error {
+	atomic.AddInt32(&counted, 1)
+	time.Sleep(50 * time.Millisecond)
+	*B = A.A + A.B
+	return nil
+}
+
+func TestCollapse(t *testing.T) {
+	server := GetServer()
+	server.Register("counted", (*Func).Counted)
+	client := GetClient()
+	if err := client.Dial(serve(t, server)); err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	client.Collapse(100*time.Millisecond, "counted")
+
+	atomic.StoreInt32(&counted, 0)
+	replies := make([]int, 8)
+	wg := new(sync.WaitGroup)
+	for i := range replies {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := client.Call("counted", Struct1{1, i % 2}, &replies[i]); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	for i, reply := range replies {
+		if reply != 1+i%2 {
+			t.Errorf("expect %v, output %v", 1+i%2, reply)
+		}
+	}
+	if n := atomic.LoadInt32(&counted); n != 2 {
+		t.Errorf("expect 2 calls on the wire, output %v", n)
+	}
+
+	var reply int
+	if err := client.Call("counted", Struct1{1, 0}, &reply); err != nil || reply != 1 || atomic.LoadInt32(&counted) != 2 {
+		t.Errorf("expect a cached reply, output %v %v", reply, err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if err := client.Call("counted", Struct1{1, 0}, &reply); err != nil || atomic.LoadInt32(&counted) != 3 {
+		t.Errorf("expect the cache to expire, output %v", err)
+	}
+}
@@ -0,0 +1,554 @@
+package rpc_yqaty
+
+import (
+	"io"
+	"reflect"
+	"sync"
+)
+
+const (
+	FrameCall = iota
+	FrameData
+	FrameEnd
+	FrameCancel
+	FrameCredit
+	FramePing
+	FramePong
+	FrameHello
+)
+
+const DefaultStreamWindow = 64
+
+var (
+	errStreamCanceled = &Error{Code: CodeCanceled, Message: "the stream is canceled"}
+	errSendClosed     = &Error{Code: CodeCanceled, Message: "send on a closed stream"}
+)
+
+type senderBinder interface {
+	bindSender(stream *serverStream)
+}
+
+type receiverBinder interface {
+	bindReceiver(stream *serverStream)
+}
+
+var (
+	senderBinderType   = reflect.TypeOf((*senderBinder)(nil)).Elem()
+	receiverBinderType = reflect.TypeOf((*receiverBinder)(nil)).Elem()
+)
+
+type Sender[R any] struct {
+	stream *serverStream
+}
+
+func (sender *Sender[R]) bindSender(stream *serverStream) {
+	sender.stream = stream
+}
+
+func (sender Sender[R]) Send(item R) error {
+	return sender.stream.send(item)
+}
+
+func (sender Sender[R]) Done() <-chan struct{} {
+	return sender.stream.done
+}
+
+type Receiver[T any] struct {
+	stream *serverStream
+}
+
+func (receiver *Receiver[T]) bindReceiver(stream *serverStream) {
+	receiver.stream = stream
+}
+
+func (receiver Receiver[T]) Recv() (T, error) {
+	item, err := receiver.stream.recv()
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return *item.(*T), nil
+}
+
+func (receiver Receiver[T]) Done() <-chan struct{} {
+	return receiver.stream.done
+}
+
+type serverStream struct {
+	conn     *serverConn
+	seq      uint64
+	mutex    sync.Mutex
+	cond     *sync.Cond
+	credit   uint64
+	limited  bool
+	canceled bool
+	done     chan struct{}
+	recvType reflect.Type
+	items    chan any
+	window   uint64
+	received uint64
+	halfdone bool
+	eof      chan struct{}
+}
+
+func (stream *serverStream) send(item any) error {
+	stream.mutex.Lock()
+	for stream.limited && stream.credit == 0 && !stream.canceled {
+		stream.cond.Wait()
+	}
+	if stream.canceled {
+		stream.mutex.Unlock()
+		return errStreamCanceled
+	}
+	stream.credit--
+	stream.mutex.Unlock()
+	return stream.conn.send(&Response{Seq: stream.seq, Frame: FrameData}, &Data{item})
+}
+
+func (stream *serverStream) recv() (any, error) {
+	var item any
+	select {
+	case item = <-stream.items:
+	case <-stream.done:
+		return nil, errStreamCanceled
+	case <-stream.eof:
+		select {
+		case item = <-stream.items:
+		default:
+			return nil, io.EOF
+		}
+	}
+	stream.received++
+	if stream.received >= (stream.window+1)/2 {
+		stream.conn.send(&Response{Seq: stream.seq, Frame: FrameCredit, Credit: stream.received}, &Data{nil})
+		stream.received = 0
+	}
+	return item, nil
+}
+
+func (stream *serverStream) addCredit(credit uint64) {
+	stream.mutex.Lock()
+	stream.credit += credit
+	stream.cond.Broadcast()
+	stream.mutex.Unlock()
+}
+
+func (stream *serverStream) closeRecv() {
+	stream.mutex.Lock()
+	if !stream.halfdone && stream.eof != nil {
+		stream.halfdone = true
+		close(stream.eof)
+	}
+	stream.mutex.Unlock()
+}
+
+func (stream *serverStream) cancel() {
+	stream.mutex.Lock()
+	if !stream.canceled {
+		stream.canceled = true
+		close(stream.done)
+		stream.cond.Broadcast()
+	}
+	stream.mutex.Unlock()
+}
+
+func (conn *serverConn) openStream(req *Request, method *MethodType) *serverStream {
+	stream := &serverStream{conn: conn, seq: req.Seq, credit: req.Credit, limited: req.Credit > 0, done: make(chan struct{})}
+	stream.cond = sync.NewCond(&stream.mutex)
+	if method.ClientStream {
+		recv, _ := method.ArgsType.MethodByName("Recv")
+		stream.recvType = recv.Type.Out(0)
+		stream.window = DefaultStreamWindow
+		stream.items = make(chan any, stream.window)
+		stream.eof = make(chan struct{})
+	}
+	conn.mutex.Lock()
+	conn.streams[req.Seq] = stream
+	conn.mutex.Unlock()
+	return stream
+}
+
+func (conn *serverConn) closeStream(seq uint64) {
+	conn.mutex.Lock()
+	delete(conn.streams, seq)
+	conn.mutex.Unlock()
+}
+
+func (conn *serverConn) control(req *Request) error {
+	conn.mutex.Lock()
+	stream := conn.streams[req.Seq]
+	conn.mutex.Unlock()
+	if req.Frame == FrameData && stream != nil && stream.items != nil {
+		item := reflect.New(stream.recvType)
+		if err := conn.codec.ReadRequestBody(item.Interface()); err != nil {
+			if err == io.EOF {
+				return err
+			}
+			stream.cancel()
+			return nil
+		}
+		select {
+		case stream.items <- item.Interface():
+		default:
+			stream.cancel()
+		}
+		return nil
+	}
+	if err := conn.codec.ReadRequestBody(nil); err != nil {
+		return err
+	}
+	if req.Frame == FramePing {
+		return conn.send(&Response{Seq: req.Seq, Frame: FramePong}, &Data{nil})
+	}
+	if stream == nil {
+		if req.Frame == FrameCancel {
+			conn.cancelCall(req.Seq)
+		}
+		return nil
+	}
+	switch req.Frame {
+	case FrameCredit:
+		stream.addCredit(req.Credit)
+	case FrameCancel:
+		stream.cancel()
+	case FrameEnd:
+		stream.closeRecv()
+	}
+	return nil
+}
+
+func (conn *serverConn) cancelStreams() {
+	conn.mutex.Lock()
+	for _, stream := range conn.streams {
+		stream.cancel()
+	}
+	conn.mutex.Unlock()
+}
+
+func (server *Server) dealStream(conn *serverConn, req *Request, method *MethodType, args reflect.Value, stream *serverStream) {
+	defer conn.wg.Done()
+	defer server.releaseStream(conn.streaming)
+	defer conn.closeStream(req.Seq)
+	in := []reflect.Value{reflect.New(method.Method.In(0).Elem()), args, {}}
+	if method.ClientStream {
+		receiver := reflect.New(method.ArgsType)
+		receiver.Interface().(receiverBinder).bindReceiver(stream)
+		in[1] = receiver.Elem()
+		conn.send(&Response{Seq: req.Seq, Frame: FrameCredit, Credit: stream.window}, &Data{nil})
+	}
+	var reply reflect.Value
+	if method.ServerStream {
+		sender := reflect.New(method.ReplyType)
+		sender.Interface().(senderBinder).bindSender(stream)
+		in[2] = sender.Elem()
+	} else {
+		reply = reflect.New(method.ReplyType.Elem())
+		in[2] = reply
+	}
+	resp := &Response{Seq: req.Seq, Frame: FrameEnd}
+	if err := callMethod(method, in); err != nil {
+		resp = errorResponse(req.Seq, err)
+		resp.Frame = FrameEnd
+	}
+	if !method.ServerStream {
+		resp.Frame = FrameCall
+		if resp.Error == "" {
+			conn.send(resp, &Data{reply.Interface()})
+			return
+		}
+	}
+	conn.send(resp, &Data{nil})
+}
+
+type clientStream struct {
+	client     *Client
+	seq        uint64
+	query      *Query
+	window     uint64
+	received   uint64
+	newItem    func() any
+	items      chan any
+	done       chan struct{}
+	err        error
+	once       sync.Once
+	mutex      sync.Mutex
+	cond       *sync.Cond
+	credit     uint64
+	sendClosed bool
+	finished   bool
+}
+
+func (stream *clientStream) finish(err error) {
+	stream.once.Do(func() {
+		stream.mutex.Lock()
+		stream.err = err
+		stream.finished = true
+		close(stream.done)
+		stream.cond.Broadcast()
+		stream.mutex.Unlock()
+	})
+}
+
+func (stream *clientStream) recv() (any, error) {
+	var item any
+	select {
+	case item = <-stream.items:
+	case <-stream.done:
+		select {
+		case item = <-stream.items:
+		default:
+			return nil, stream.err
+		}
+	}
+	stream.received++
+	if stream.received >= (stream.window+1)/2 {
+		select {
+		case <-stream.done:
+		default:
+			stream.client.SendRequest(&Request{Seq: stream.seq, Frame: FrameCredit, Credit: stream.received}, nil)
+		}
+		stream.received = 0
+	}
+	return item, nil
+}
+
+func (stream *clientStream) send(item any) error {
+	stream.mutex.Lock()
+	for stream.credit == 0 && !stream.finished && !stream.sendClosed {
+		stream.cond.Wait()
+	}
+	if stream.sendClosed {
+		stream.mutex.Unlock()
+		return errSendClosed
+	}
+	if stream.finished {
+		err := stream.err
+		stream.mutex.Unlock()
+		if err == errStreamCanceled {
+			return err
+		}
+		return io.EOF
+	}
+	stream.credit--
+	stream.mutex.Unlock()
+	return stream.client.SendRequest(&Request{Seq: stream.seq, Frame: FrameData}, item)
+}
+
+func (stream *clientStream) closeSend() error {
+	stream.mutex.Lock()
+	if stream.sendClosed || stream.finished {
+		stream.mutex.Unlock()
+		return nil
+	}
+	stream.sendClosed = true
+	stream.cond.Broadcast()
+	stream.mutex.Unlock()
+	return stream.client.SendRequest(&Request{Seq: stream.seq, Frame: FrameEnd}, nil)
+}
+
+func (stream *clientStream) addCredit(credit uint64) {
+	stream.mutex.Lock()
+	stream.credit += credit
+	stream.cond.Broadcast()
+	stream.mutex.Unlock()
+}
+
+func (stream *clientStream) cancel() {
+	client := stream.client
+	client.mutex.Lock()
+	delete(client.streams, stream.seq)
+	query := stream.query
+	if query != nil && client.pending[stream.seq] == query {
+		delete(client.pending, stream.seq)
+	} else {
+		query = nil
+	}
+	client.mutex.Unlock()
+	select {
+	case <-stream.done:
+		return
+	default:
+	}
+	stream.finish(errStreamCanceled)
+	if query != nil {
+		query.Error = errStreamCanceled
+		query.done()
+	}
+	client.SendRequest(&Request{Seq: stream.seq, Frame: FrameCancel}, nil)
+}
+
+func (client *Client) openStream(newItem func() any, query *Query) (*clientStream, error) {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+	if client.closing {
+		return nil, errShutdown
+	}
+	window := client.StreamWindow
+	if window == 0 {
+		window = DefaultStreamWindow
+	}
+	client.seq++
+	stream := &clientStream{client: client, seq: client.seq, query: query, window: window, newItem: newItem, done: make(chan struct{})}
+	stream.cond = sync.NewCond(&stream.mutex)
+	if newItem != nil {
+		stream.items = make(chan any, window)
+	}
+	client.streams[stream.seq] = stream
+	if query != nil {
+		query.seq = stream.seq
+		client.pending[stream.seq] = query
+	}
+	return stream, nil
+}
+
+func (client *Client) closeStream(seq uint64) {
+	client.mutex.Lock()
+	delete(client.streams, seq)
+	delete(client.pending, seq)
+	client.mutex.Unlock()
+}
+
+func (client *Client) dealStream(resp *Response) error {
+	client.mutex.Lock()
+	stream := client.streams[resp.Seq]
+	if resp.Frame == FrameEnd {
+		delete(client.streams, resp.Seq)
+	}
+	client.mutex.Unlock()
+	if stream == nil || resp.Frame != FrameData {
+		if err := client.codec.ReadResponseBody(nil); err != nil {
+			return err
+		}
+		if stream == nil {
+			return nil
+		}
+		switch {
+		case resp.Frame == FrameCredit:
+			stream.addCredit(resp.Credit)
+		case resp.Error != "":
+			stream.finish(responseError(resp))
+		default:
+			stream.finish(io.EOF)
+		}
+		return nil
+	}
+	if stream.items == nil {
+		stream.cancel()
+		return client.codec.ReadResponseBody(nil)
+	}
+	data := Data{Reply: stream.newItem()}
+	if err := client.codec.ReadResponseBody(&data); err != nil {
+		return err
+	}
+	select {
+	case stream.items <- data.Reply:
+	default:
+		stream.cancel()
+	}
+	return nil
+}
+
+type ClientStream[R any] struct {
+	stream *clientStream
+}
+
+func (s *ClientStream[R]) Recv() (R, error) {
+	item, err := s.stream.recv()
+	if err != nil {
+		var zero R
+		return zero, err
+	}
+	return *item.(*R), nil
+}
+
+func (s *ClientStream[R]) Cancel() {
+	s.stream.cancel()
+}
+
+func CallStream[R any](client *Client, name string, args any) (*ClientStream[R], error) {
+	stream, err := client.openStream(func() any { return new(R) }, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := client.SendRequest(&Request{MethodName: name, Seq: stream.seq, Credit: stream.window, Stream: true}, args); err != nil {
+		client.closeStream(stream.seq)
+		return nil, err
+	}
+	return &ClientStream[R]{stream}, nil
+}
+
+type SendStream[S, R any] struct {
+	stream *clientStream
+	reply  *R
+}
+
+func (s *SendStream[S, R]) Send(item S) error {
+	return s.stream.send(item)
+}
+
+func (s *SendStream[S, R]) CloseAndRecv() (R, error) {
+	var zero R
+	if err := s.stream.closeSend(); err != nil {
+		return zero, err
+	}
+	query := <-s.stream.query.Done
+	if query.Error != nil {
+		return zero, query.Error
+	}
+	return *s.reply, nil
+}
+
+func (s *SendStream[S, R]) Cancel() {
+	s.stream.cancel()
+}
+
+func OpenSendStream[S, R any](client *Client, name string) (*SendStream[S, R], error) {
+	reply := new(R)
+	query := &Query{Method: name, Reply: reply, Done: make(chan *Query, 1)}
+	stream, err := client.openStream(nil, query)
+	if err != nil {
+		return nil, err
+	}
+	if err := client.SendRequest(&Request{MethodName: name, Seq: stream.seq, Stream: true}, nil); err != nil {
+		client.closeStream(stream.seq)
+		return nil, err
+	}
+	return &SendStream[S, R]{stream, reply}, nil
+}
+
+type BidiStream[S, R any] struct {
+	stream *clientStream
+}
+
+func (s *BidiStream[S, R]) Send(item S) error {
+	return s.stream.send(item)
+}
+
+func (s *BidiStream[S, R]) CloseSend() error {
+	return s.stream.closeSend()
+}
+
+func (s *BidiStream[S, R]) Recv() (R, error) {
+	item, err := s.stream.recv()
+	if err != nil {
+		var zero R
+		return zero, err
+	}
+	return *item.(*R), nil
+}
+
+func (s *BidiStream[S, R]) Cancel() {
+	s.stream.cancel()
+}
+
+func OpenBidiStream[S, R any](client *Client, name string) (*BidiStream[S, R], error) {
+	stream, err := client.openStream(func() any { return new(R) }, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := client.SendRequest(&Request{MethodName: name, Seq: stream.seq, Credit: stream.window, Stream: true}, nil); err != nil {
+		client.closeStream(stream.seq)
+		return nil, err
+	}
+	return &BidiStream[S, R]{stream}, nil
+}
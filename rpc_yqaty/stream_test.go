@@ -0,0 +1,201 @@
+package rpc_yqaty
+
+import (
+	"errors"
+	"io"
+	"testing"
+)
+
+var forever = make(chan error, 1)
+
+func (f *Func) Count(A Struct1, stream Sender[int]) error {
+	for i := A.A; i < A.B; i++ {
+		if err := stream.Send(i); err != nil {
+			return err
+		}
+	}
+	if A.B < A.A {
+		return errors.New("bad range")
+	}
+	return nil
+}
+
+func (f *Func) Forever(A Struct1, stream Sender[Struct1]) error {
+	for {
+		if err := stream.Send(A); err != nil {
+			forever <- err
+			return err
+		}
+		A.A++
+	}
+}
+
+func TestServerStream(t *testing.T) {
+	server := GetServer()
+	if err := server.Register("count", (*Func).Count); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.Register("forever", (*Func).Forever); err != nil {
+		t.Fatal(err)
+	}
+	client := GetClient()
+	client.StreamWindow = 4
+	if err := client.Dial(serve(t, server)); err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	{
+		stream, err := CallStream[int](client, "count", Struct1{0, 100})
+		if err != nil {
+			t.Fatal(err)
+		}
+		sum := 0
+		for {
+			i, err := stream.Recv()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			sum += i
+		}
+		if sum != 4950 {
+			t.Errorf("count: expect 4950, output %d", sum)
+		}
+	}
+
+	{
+		stream, err := CallStream[int](client, "count", Struct1{2, 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := stream.Recv(); err == nil || err.Error() != "bad range" {
+			t.Errorf("count: expect error bad range, output %v", err)
+		}
+	}
+
+	{
+		stream, err := CallStream[Struct1](client, "forever", Struct1{0, 0})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 10; i++ {
+			if reply, err := stream.Recv(); err != nil || reply.A != i {
+				t.Fatalf("forever: expect %d, output %v %v", i, reply.A, err)
+			}
+		}
+		stream.Cancel()
+		if err := <-forever; err != errStreamCanceled {
+			t.Errorf("forever: expect handler to see %v, output %v", errStreamCanceled, err)
+		}
+	}
+
+	reply := new(int)
+	if err := client.Call("count", Struct1{1, 2}, reply); err == nil {
+		t.Error("count: expect unary call on a stream method to fail")
+	}
+}
+
+func (f *Func) Sum(stream Receiver[int], B *int) error {
+	for {
+		i, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		*B += i
+	}
+}
+
+func (f *Func) Echo(recv Receiver[Struct1], send Sender[int]) error {
+	for {
+		A, err := recv.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := send.Send(A.A + A.B); err != nil {
+			return err
+		}
+	}
+}
+
+func TestClientStream(t *testing.T) {
+	server := GetServer()
+	if err := server.Register("sum", (*Func).Sum); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.Register("echo", (*Func).Echo); err != nil {
+		t.Fatal(err)
+	}
+	client := GetClient()
+	client.StreamWindow = 4
+	if err := client.Dial(serve(t, server)); err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	{
+		stream, err := OpenSendStream[int, int](client, "sum")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 200; i++ {
+			if err := stream.Send(i); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if sum, err := stream.CloseAndRecv(); err != nil || sum != 19900 {
+			t.Errorf("sum: expect 19900, output %v %v", sum, err)
+		}
+		if err := stream.Send(1); err != errSendClosed {
+			t.Errorf("sum: expect %v after CloseAndRecv, output %v", errSendClosed, err)
+		}
+	}
+
+	{
+		stream, err := OpenSendStream[int, int](client, "sum")
+		if err != nil {
+			t.Fatal(err)
+		}
+		stream.Send(1)
+		stream.Cancel()
+		if _, err := stream.CloseAndRecv(); err != errStreamCanceled {
+			t.Errorf("sum: expect %v, output %v", errStreamCanceled, err)
+		}
+	}
+
+	{
+		stream, err := OpenBidiStream[Struct1, int](client, "echo")
+		if err != nil {
+			t.Fatal(err)
+		}
+		go func() {
+			for i := 0; i < 100; i++ {
+				if err := stream.Send(Struct1{i, i}); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+			stream.CloseSend()
+		}()
+		for i := 0; ; i++ {
+			reply, err := stream.Recv()
+			if err == io.EOF {
+				if i != 100 {
+					t.Errorf("echo: expect 100 replies, output %d", i)
+				}
+				break
+			}
+			if err != nil || reply != 2*i {
+				t.Fatalf("echo: expect %d, output %v %v", 2*i, reply, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,327 @@
+package rpc_yqaty
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	WebSocketPath      = "/ws"
+	JSONRPCSubprotocol = "jsonrpc"
+	websocketGUID      = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+)
+
+const (
+	wsContinuation = 0x0
+	wsText         = 0x1
+	wsBinary       = 0x2
+	wsClose        = 0x8
+	wsPing         = 0x9
+	wsPong         = 0xa
+)
+
+var (
+	errFrameTooLarge = errors.New("websocket: frame exceeds the message size limit")
+	errFrameUnmasked = errors.New("websocket: client frames must be masked")
+)
+
+type wsConn struct {
+	conn    net.Conn
+	reader  *bufio.Reader
+	client  bool
+	limit   int64
+	payload []byte
+	writing sync.Mutex
+}
+
+func (ws *wsConn) Read(p []byte) (int, error) {
+	for len(ws.payload) == 0 {
+		if err := ws.readFrame(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, ws.payload)
+	ws.payload = ws.payload[n:]
+	return n, nil
+}
+
+func (ws *wsConn) readFrame() error {
+	var head [2]byte
+	if _, err := io.ReadFull(ws.reader, head[:]); err != nil {
+		return err
+	}
+	opcode := head[0] & 0x0f
+	masked := head[1]&0x80 != 0
+	length := uint64(head[1] & 0x7f)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(ws.reader, ext[:]); err != nil {
+			return err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(ws.reader, ext[:]); err != nil {
+			return err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+	if !ws.client && !masked {
+		ws.writeFrame(wsClose, []byte{0x03, 0xea})
+		return errFrameUnmasked
+	}
+	if ws.limit > 0 && length > uint64(ws.limit) {
+		ws.writeFrame(wsClose, []byte{0x03, 0xf1})
+		return errFrameTooLarge
+	}
+	var mask [4]byte
+	if masked {
+		if _, err := io.ReadFull(ws.reader, mask[:]); err != nil {
+			return err
+		}
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(ws.reader, payload); err != nil {
+		return err
+	}
+	if masked {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+	switch opcode {
+	case wsContinuation, wsText, wsBinary:
+		ws.payload = payload
+	case wsPing:
+		return ws.writeFrame(wsPong, payload)
+	case wsPong:
+	case wsClose:
+		ws.writeFrame(wsClose, payload)
+		return io.EOF
+	default:
+		return errors.New("websocket: unknown opcode")
+	}
+	return nil
+}
+
+func (ws *wsConn) writeFrame(opcode byte, payload []byte) error {
+	frame := make([]byte, 0, len(payload)+14)
+	frame = append(frame, 0x80|opcode)
+	var maskbit byte
+	if ws.client {
+		maskbit = 0x80
+	}
+	switch {
+	case len(payload) < 126:
+		frame = append(frame, maskbit|byte(len(payload)))
+	case len(payload) <= 0xffff:
+		frame = append(frame, maskbit|126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(len(payload)))
+	default:
+		frame = append(frame, maskbit|127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(len(payload)))
+	}
+	if ws.client {
+		var mask [4]byte
+		if _, err := rand.Read(mask[:]); err != nil {
+			return err
+		}
+		frame = append(frame, mask[:]...)
+		for i, b := range payload {
+			frame = append(frame, b^mask[i%4])
+		}
+	} else {
+		frame = append(frame, payload...)
+	}
+	ws.writing.Lock()
+	defer ws.writing.Unlock()
+	_, err := ws.conn.Write(frame)
+	return err
+}
+
+func (ws *wsConn) Write(p []byte) (int, error) {
+	if err := ws.writeFrame(wsText, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (ws *wsConn) SetReadDeadline(t time.Time) error {
+	return ws.conn.SetReadDeadline(t)
+}
+
+func (ws *wsConn) RemoteAddr() net.Addr {
+	return ws.conn.RemoteAddr()
+}
+
+func (ws *wsConn) Close() error {
+	ws.writeFrame(wsClose, []byte{0x03, 0xe8})
+	return ws.conn.Close()
+}
+
+func websocketAccept(key string) string {
+	h := sha1.New()
+	io.WriteString(h, key+websocketGUID)
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+func headerContains(header http.Header, name string, value string) bool {
+	for _, v := range header.Values(name) {
+		for _, s := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(s), value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func isWebSocketUpgrade(r *http.Request) bool {
+	return r.Method == http.MethodGet && headerContains(r.Header, "Connection", "upgrade") && headerContains(r.Header, "Upgrade", "websocket")
+}
+
+func (server *Server) ServeWebSocket(w http.ResponseWriter, r *http.Request) {
+	if !isWebSocketUpgrade(r) {
+		http.Error(w, "rpc: websocket upgrade required", http.StatusBadRequest)
+		return
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if key == "" || r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "rpc: unsupported websocket version", http.StatusBadRequest)
+		return
+	}
+	if !server.allowOrigin(r) {
+		http.Error(w, "rpc: websocket origin not allowed", http.StatusForbidden)
+		return
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "rpc: connection can not be hijacked", http.StatusInternalServerError)
+		return
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return
+	}
+	jsonrpc := headerContains(r.Header, "Sec-WebSocket-Protocol", JSONRPCSubprotocol)
+	resp := "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: " + websocketAccept(key) + "\r\n"
+	if jsonrpc {
+		resp += "Sec-WebSocket-Protocol: " + JSONRPCSubprotocol + "\r\n"
+	}
+	if _, err := io.WriteString(conn, resp+"\r\n"); err != nil {
+		conn.Close()
+		return
+	}
+	ws := &wsConn{conn: conn, reader: rw.Reader, limit: server.Limits.withDefaults().MaxMessageBytes}
+	if jsonrpc {
+		server.ServeJSONRPC(ws)
+		return
+	}
+	server.InitCodec(ws)
+}
+
+func (server *Server) allowOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	for _, allowed := range server.AllowedOrigins {
+		if allowed == "*" || strings.EqualFold(strings.TrimSuffix(allowed, "/"), origin) {
+			return true
+		}
+	}
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
+
+func dialWebSocket(rawurl string, protocol string) (*wsConn, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	var conn net.Conn
+	switch u.Scheme {
+	case "ws":
+		conn, err = net.Dial("tcp", u.Host)
+	case "wss":
+		conn, err = tls.Dial("tcp", u.Host, nil)
+	default:
+		return nil, errors.New("websocket: unsupported scheme " + u.Scheme)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var nonce [16]byte
+	rand.Read(nonce[:])
+	key := base64.StdEncoding.EncodeToString(nonce[:])
+	req := &http.Request{
+		Method:     http.MethodGet,
+		URL:        u,
+		Host:       u.Host,
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header: http.Header{
+			"Upgrade":               {"websocket"},
+			"Connection":            {"Upgrade"},
+			"Sec-WebSocket-Key":     {key},
+			"Sec-WebSocket-Version": {"13"},
+		},
+	}
+	if protocol != "" {
+		req.Header.Set("Sec-WebSocket-Protocol", protocol)
+	}
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, req)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols || resp.Header.Get("Sec-WebSocket-Accept") != websocketAccept(key) {
+		conn.Close()
+		return nil, errors.New("websocket: unexpected HTTP response: " + resp.Status)
+	}
+	if protocol != "" && resp.Header.Get("Sec-WebSocket-Protocol") != protocol {
+		conn.Close()
+		return nil, errors.New("websocket: server does not support subprotocol " + protocol)
+	}
+	return &wsConn{conn: conn, reader: reader, client: true}, nil
+}
+
+func (client *Client) DialWebSocket(rawurl string) error {
+	ws, err := dialWebSocket(rawurl, "")
+	if err != nil {
+		return err
+	}
+	ws.limit = client.Limits.withDefaults().MaxMessageBytes
+	client.InitCodec(ws)
+	return client.start()
+}
+
+func (client *Client) DialWebSocketJSONRPC(rawurl string) error {
+	ws, err := dialWebSocket(rawurl, JSONRPCSubprotocol)
+	if err != nil {
+		return err
+	}
+	ws.limit = client.Limits.withDefaults().MaxMessageBytes
+	client.InitJSONRPCCodec(ws)
+	go client.Listen()
+	return nil
+}
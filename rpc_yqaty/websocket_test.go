@@ -0,0 +1,109 @@
+package rpc_yqaty
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestWebSocket(t *testing.T) {
+	server := GetServer()
+	server.Register("add", (*Func).Add)
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+	url := "ws://" + ts.Listener.Addr().String() + WebSocketPath
+
+	{
+		client := GetClient()
+		if err := client.DialWebSocket(url); err != nil {
+			t.Fatal(err)
+		}
+		reply := new(int)
+		if err := client.Call("add", Struct1{1, 2}, reply); err != nil || *reply != 3 {
+			t.Errorf("add: reply %v, err %v", *reply, err)
+		}
+		client.Close()
+	}
+
+	{
+		client := GetClient()
+		if err := client.DialWebSocketJSONRPC(url); err != nil {
+			t.Fatal(err)
+		}
+		reply := new(int)
+		if err := client.Call("add", Struct1{3, 4}, reply); err != nil || *reply != 7 {
+			t.Errorf("jsonrpc add: reply %v, err %v", *reply, err)
+		}
+		client.Close()
+	}
+}
+
+func TestWebSocketFrameLimits(t *testing.T) {
+	server := GetServer()
+	server.Register("add", (*Func).Add)
+	server.Limits.MaxMessageBytes = 1 << 10
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+	url := "ws://" + ts.Listener.Addr().String() + WebSocketPath
+
+	frames := map[string][]byte{
+		"huge":     {0x81, 0xff, 0x7f, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0, 0, 0, 0},
+		"large":    {0x81, 0xfe, 0x08, 0x00, 0, 0, 0, 0},
+		"unmasked": {0x81, 0x02, '{', '}'},
+	}
+	for name, frame := range frames {
+		for _, protocol := range []string{"", JSONRPCSubprotocol} {
+			ws, err := dialWebSocket(url, protocol)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := ws.conn.Write(frame); err != nil {
+				t.Fatal(err)
+			}
+			ws.conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+			if _, err := ws.Read(make([]byte, 16)); err != io.EOF {
+				t.Errorf("%s %q: expect the server to close the connection, output %v", name, protocol, err)
+			}
+			ws.conn.Close()
+		}
+	}
+}
+
+func TestWebSocketOrigin(t *testing.T) {
+	server := GetServer()
+	server.Register("add", (*Func).Add)
+	server.AllowedOrigins = []string{"https://app.example.com"}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	tests := map[string]int{
+		"":                                      http.StatusSwitchingProtocols,
+		"http://" + ts.Listener.Addr().String(): http.StatusSwitchingProtocols,
+		"https://app.example.com":               http.StatusSwitchingProtocols,
+		"https://evil.example.com":              http.StatusForbidden,
+		"null":                                  http.StatusForbidden,
+	}
+	for origin, code := range tests {
+		req, err := http.NewRequest(http.MethodGet, ts.URL+WebSocketPath, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Upgrade", "websocket")
+		req.Header.Set("Connection", "Upgrade")
+		req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+		req.Header.Set("Sec-WebSocket-Version", "13")
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != code {
+			t.Errorf("origin %q: expect status %v, output %v", origin, code, resp.StatusCode)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package rpc_yqaty
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"sync"
+)
+
+type encodeWriter interface {
+	io.Writer
+	io.ByteWriter
+	io.StringWriter
+	WriteRune(r rune) (int, error)
+}
+
+var bufferPool = sync.Pool{New: func() any { return new(bytes.Buffer) }}
+
+func getBuffer() *bytes.Buffer {
+	buf := bufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	return buf
+}
+
+func putBuffer(buf *bytes.Buffer) {
+	if buf.Cap() <= 1<<20 {
+		bufferPool.Put(buf)
+	}
+}
+
+var errBrokenStream = &Error{Code: CodeInternal, Message: "the connection is broken by a partially written message"}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+type messageWriter struct {
+	out        *countingWriter
+	w          *bufio.Writer
+	encoder    *Encoder
+	compressor Compressor
+	threshold  int
+	broken     bool
+}
+
+func newMessageWriter(w io.Writer) *messageWriter {
+	out := &countingWriter{w: w}
+	buffered := bufio.NewWriter(out)
+	return &messageWriter{out: out, w: buffered, encoder: &Encoder{buffered}}
+}
+
+func (mw *messageWriter) write(header any, compression *string, data any) error {
+	if mw.broken {
+		return errBrokenStream
+	}
+	start := mw.out.n
+	if err := mw.encode(header, compression, data); err != nil {
+		if mw.out.n != start {
+			mw.broken = true
+			return errors.Join(err, errBrokenStream)
+		}
+		mw.w.Reset(mw.out)
+		return err
+	}
+	return mw.w.Flush()
+}
+
+func (mw *messageWriter) encode(header any, compression *string, data any) error {
+	*compression = ""
+	if mw.compressor == nil {
+		if err := mw.encoder.JSONEncode(header); err != nil {
+			return err
+		}
+		if err := mw.encoder.JSONEncode(data); err != nil {
+			return err
+		}
+		return mw.w.WriteByte(' ')
+	}
+	buf := getBuffer()
+	defer putBuffer(buf)
+	body, name, err := encodeBody(buf, data, mw.compressor, mw.threshold)
+	if err != nil {
+		return err
+	}
+	*compression = name
+	if err := mw.encoder.JSONEncode(header); err != nil {
+		return err
+	}
+	mw.w.Write(body)
+	return mw.w.WriteByte(' ')
+}
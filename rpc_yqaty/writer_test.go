@@ -0,0 +1,140 @@
+package rpc_yqaty
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func (f *Func) NaN(A Struct1, B *float64) error {
+	*B = math.NaN()
+	return nil
+}
+
+func (f *Func) NaNs(A Struct1, B *[]float64) error {
+	*B = make([]float64, A.A)
+	(*B)[A.A-1] = math.NaN()
+	return nil
+}
+
+func TestMessageWriterBroken(t *testing.T) {
+	server := GetServer()
+	server.Register("nans", (*Func).NaNs)
+	server.Register("add", (*Func).Add)
+	addr := serve(t, server)
+	client := GetClient()
+	if err := client.Dial(addr); err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	begin := time.Now()
+	var reply []float64
+	if err := client.Call("nans", Struct1{10000, 0}, &reply); err == nil {
+		t.Errorf("expect a reply broken after a flush to fail")
+	}
+	if err := client.Call("add", Struct1{1, 2}, new(int)); err == nil {
+		t.Errorf("expect the broken connection to be closed")
+	}
+	if cost := time.Since(begin); cost > time.Second {
+		t.Errorf("expect calls on the broken connection to fail fast, took %v", cost)
+	}
+}
+
+func TestMessageWriter(t *testing.T) {
+	server := GetServer()
+	server.Register("repeat", (*Func).Repeat)
+	server.Register("nan", (*Func).NaN)
+	addr := serve(t, server)
+	client := GetClient()
+	if err := client.Dial(addr); err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	var reply string
+	if err := client.Call("repeat", Struct1{200000, 0}, &reply); err != nil || reply != strings.Repeat("compressible ", 200000) {
+		t.Fatalf("unexpected reply of length %v, %v", len(reply), err)
+	}
+	var f float64
+	if err := client.Call("nan", Struct1{}, &f); ErrorCode(err) != CodeInternal {
+		t.Errorf("expect an internal error for an unencodable reply, output %v", err)
+	}
+	if err := client.Call("repeat", Struct1{2, 0}, &reply); err != nil || reply != "compressible compressible " {
+		t.Errorf("expect the connection to survive, output %q, %v", reply, err)
+	}
+
+	var out bytes.Buffer
+	writer := newMessageWriter(&out)
+	resp := &Response{Seq: 1}
+	if err := writer.write(resp, &resp.Compression, &Data{math.Inf(1)}); err == nil || out.Len() != 0 {
+		t.Errorf("expect a failed message to be discarded, output %q, %v", out.String(), err)
+	}
+	if err := writer.write(resp, &resp.Compression, &Data{1}); err != nil || out.String() != `{"Seq":1,"Error":"","Code":0,"RetryAfter":0,"Frame":0,"Credit":0,"Compression":""}{"Reply":1} ` {
+		t.Errorf("unexpected message %q, %v", out.String(), err)
+	}
+}
+
+func writeBuffered(w io.Writer, resp *Response, data *Data) error {
+	body := &Encoder{new(bytes.Buffer)}
+	if err := body.JSONEncode(data); err != nil {
+		return err
+	}
+	encoder := &Encoder{new(bytes.Buffer)}
+	if err := encoder.JSONEncode(resp); err != nil {
+		return err
+	}
+	buf := encoder.s.(*bytes.Buffer)
+	buf.Write(body.s.(*bytes.Buffer).Bytes())
+	buf.WriteString(" ")
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+func BenchmarkWriteResponse(b *testing.B) {
+	sizes := map[string]*Data{
+		"small": {Struct4{A: &Struct3{A: 1, B: "dsds"}, Mp: map[int]string{1: "adas"}, Ar: []int{1, 2, 3}}},
+		"large": {strings.Repeat("payload ", 1<<17)},
+	}
+	for name, data := range sizes {
+		b.Run(name+"/buffer", func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if err := writeBuffered(io.Discard, &Response{Seq: uint64(i)}, data); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		b.Run(name+"/pooled", func(b *testing.B) {
+			b.ReportAllocs()
+			writer := newMessageWriter(io.Discard)
+			for i := 0; i < b.N; i++ {
+				resp := &Response{Seq: uint64(i)}
+				if err := writer.write(resp, &resp.Compression, data); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkCall(b *testing.B) {
+	server := GetServer()
+	server.Register("add", (*Func).Add)
+	addr := serve(b, server)
+	client := GetClient()
+	if err := client.Dial(addr); err != nil {
+		b.Fatal(err)
+	}
+	defer client.Close()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var reply int
+		if err := client.Call("add", Struct1{i, 1}, &reply); err != nil {
+			b.Fatal(err)
+		}
+	}
+}